@@ -13,7 +13,7 @@ func main() {
 
 	// Intercept request and modify URI path
 	vs.Use(intercept.Request(func(req *intercept.RequestModifier) {
-		req.Request.RequestURI = "/html"
+		req.SetPath("/html")
 	}))
 
 	// Intercept and replace response body
@@ -0,0 +1,166 @@
+package intercept
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// bodyCacheKey is the context key used to store the body cache of a request.
+type bodyCacheKey struct{}
+
+// bodyCache caches the request and response bodies read and decoded by the modifiers,
+// so chained interceptors share a single read and decode of the same body.
+type bodyCache struct {
+	request  cachedBody
+	response cachedBody
+}
+
+// withBodyCache returns the given request with a body cache in its context, if not present yet.
+func withBodyCache(r *http.Request) *http.Request {
+	if getBodyCache(r.Context()) != nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), bodyCacheKey{}, &bodyCache{}))
+}
+
+// getBodyCache returns the body cache stored in the given context, if any.
+func getBodyCache(ctx context.Context) *bodyCache {
+	cache, _ := ctx.Value(bodyCacheKey{}).(*bodyCache)
+	return cache
+}
+
+// cachedValueKey identifies a decoded value by format and type.
+type cachedValueKey struct {
+	format string
+	typ    reflect.Type
+}
+
+// cachedBody stores a body as read and decoded, and the values decoded from it.
+// The cached data is valid as long as the body reading it has not been replaced.
+// Methods can be called on a nil cachedBody, disabling the cache.
+type cachedBody struct {
+	mutex   sync.Mutex
+	body    io.ReadCloser
+	raw     []byte
+	decoded []byte
+	values  map[cachedValueKey]reflect.Value
+}
+
+// get returns the cached decoded body if the given body has not been replaced since cached,
+// and neither its raw nor decoded size exceed the given limit. The body is rewound to its start.
+func (c *cachedBody) get(body *io.ReadCloser, limit int64) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.body == nil || *body != c.body || checkLimit(int64(len(c.raw)), limit) != nil || checkLimit(int64(len(c.decoded)), limit) != nil {
+		return nil, false
+	}
+	*body = c.rewind()
+	return c.decoded, true
+}
+
+// set caches the given raw and decoded body, returning a new body that reads the raw one.
+func (c *cachedBody) set(raw, decoded []byte) io.ReadCloser {
+	if c == nil {
+		return ioutil.NopCloser(bytes.NewReader(raw))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.raw = raw
+	c.decoded = decoded
+	c.values = nil
+	return c.rewind()
+}
+
+// match returns a body that reads the cached raw body if it is equal to the given one,
+// so bodies written untouched by a previous modifier reuse its cache.
+func (c *cachedBody) match(raw []byte) (io.ReadCloser, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.body == nil || !bytes.Equal(c.raw, raw) {
+		return nil, false
+	}
+	return c.rewind(), true
+}
+
+// source returns the cached raw body if the given body reads it.
+func (c *cachedBody) source(body io.ReadCloser) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.body == nil || body != c.body {
+		return nil, false
+	}
+	return c.raw, true
+}
+
+// rewind returns a new body that reads the cached raw body from the start.
+func (c *cachedBody) rewind() io.ReadCloser {
+	c.body = &readCloser{bytes.NewReader(c.raw), ioutil.NopCloser(nil)}
+	return c.body
+}
+
+// invalidate discards the cached body, as it has been replaced.
+func (c *cachedBody) invalidate() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.body = nil
+	c.raw = nil
+	c.decoded = nil
+	c.values = nil
+}
+
+// decode sets the value previously decoded from the cached body in the given format
+// and type into the given target pointer, or calls the given decode function and caches its result.
+func (c *cachedBody) decode(format string, target interface{}, decode func() error) error {
+	value := reflect.ValueOf(target)
+	if c == nil || value.Kind() != reflect.Ptr || value.IsNil() {
+		return decode()
+	}
+
+	key := cachedValueKey{format, value.Type()}
+	c.mutex.Lock()
+	cached, ok := c.values[key]
+	c.mutex.Unlock()
+	if ok {
+		value.Elem().Set(cached)
+		return nil
+	}
+
+	if err := decode(); err != nil {
+		return err
+	}
+
+	cached = reflect.New(value.Type().Elem()).Elem()
+	cached.Set(value.Elem())
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.body != nil {
+		if c.values == nil {
+			c.values = make(map[cachedValueKey]reflect.Value)
+		}
+		c.values[key] = cached
+	}
+	return nil
+}
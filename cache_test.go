@@ -0,0 +1,160 @@
+package intercept
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nbio/st"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	reader io.Reader
+	read   int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+// countingValue counts how many times it is decoded from JSON.
+type countingValue struct {
+	Name string
+}
+
+var countingDecodes int
+
+func (v *countingValue) UnmarshalJSON(data []byte) error {
+	countingDecodes++
+	var fields struct{ Name string }
+	err := json.Unmarshal(data, &fields)
+	v.Name = fields.Name
+	return err
+}
+
+// middleware is implemented by the interceptors handling the middleware call chain.
+type middleware interface {
+	HandleHTTP(http.ResponseWriter, *http.Request, http.Handler)
+}
+
+// chain calls the given middlewares in order, and then the final handler.
+func chain(handler http.Handler, middlewares ...middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		next, m := handler, middlewares[i]
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			m.HandleHTTP(w, r, next)
+		})
+	}
+	return handler
+}
+
+// serve serves the given request through the middleware and then the final handler.
+func serve(m middleware, req *http.Request, handler http.HandlerFunc) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	m.HandleHTTP(w, req, handler)
+	return w
+}
+
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	w.Write(body)
+}
+
+func TestRequestBodyCache(t *testing.T) {
+	body := &countingReader{reader: strings.NewReader(`{"name":"Rick"}`)}
+	req, _ := http.NewRequest("POST", "http://example.com/", body)
+
+	countingDecodes = 0
+	decode := func(m *RequestModifier) {
+		value := &countingValue{}
+		st.Expect(t, m.DecodeJSON(value), nil)
+		st.Expect(t, value.Name, "Rick")
+	}
+	read := RequestE(func(m *RequestModifier) error {
+		str, err := m.ReadString()
+		st.Expect(t, str, `{"name":"Rick"}`)
+		return err
+	})
+
+	w := httptest.NewRecorder()
+	chain(http.HandlerFunc(echoHandler), Request(decode), read, Request(decode)).ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), `{"name":"Rick"}`)
+	st.Expect(t, body.read, 15)
+	st.Expect(t, countingDecodes, 1)
+}
+
+func TestRequestBodyCacheInvalidation(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("Hello"))
+
+	w := httptest.NewRecorder()
+	chain(http.HandlerFunc(echoHandler),
+		Request(func(m *RequestModifier) {
+			str, _ := m.ReadString()
+			m.String(str + " world")
+		}),
+		Request(func(m *RequestModifier) {
+			str, _ := m.ReadString()
+			st.Expect(t, str, "Hello world")
+		}),
+	).ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), "Hello world")
+}
+
+func TestRequestBodyCacheFallback(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("Hello"))
+
+	failing := RequestE(func(m *RequestModifier) error {
+		io.Copy(ioutil.Discard, m.Request.Body)
+		m.String("modified")
+		return errors.New("oops")
+	})
+	failing.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) bool {
+		return false
+	}
+
+	w := httptest.NewRecorder()
+	chain(http.HandlerFunc(echoHandler),
+		Request(func(m *RequestModifier) {
+			m.ReadString()
+		}),
+		failing,
+	).ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), "Hello")
+}
+
+func TestResponseBodyCache(t *testing.T) {
+	countingDecodes = 0
+	decode := NewResponseInterceptor(func(m *ResponseModifier) {
+		value := &countingValue{}
+		st.Expect(t, m.DecodeJSON(value), nil)
+		st.Expect(t, value.Name, "Rick")
+	})
+
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Rick"}`))
+	}), decode, decode).ServeHTTP(w, req)
+	st.Expect(t, w.Body.String(), `{"name":"Rick"}`)
+	st.Expect(t, countingDecodes, 1)
+
+	// Modified bodies are decoded again
+	countingDecodes = 0
+	rename := NewResponseInterceptor(func(m *ResponseModifier) {
+		value := &countingValue{}
+		m.DecodeJSON(value)
+		m.JSON(map[string]string{"name": "Rick"})
+	})
+	w = httptest.NewRecorder()
+	chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"Morty"}`))
+	}), decode, rename).ServeHTTP(w, req)
+	st.Expect(t, countingDecodes, 2)
+}
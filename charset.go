@@ -0,0 +1,186 @@
+package intercept
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// ErrUnsupportedCharset is returned when a text is encoded in a charset that has no registered Charset.
+var ErrUnsupportedCharset = errors.New("intercept: unsupported charset")
+
+// Charset defines the interface implemented by character sets,
+// used to transparently decode text bodies into UTF-8 and encode them back.
+type Charset interface {
+	// NewDecoder returns a reader that decodes the given stream into UTF-8.
+	NewDecoder(r io.Reader) io.Reader
+
+	// NewEncoder returns a writer that encodes UTF-8 text into the given writer.
+	// Encoders fail on characters that cannot be represented in the charset.
+	NewEncoder(w io.Writer) io.WriteCloser
+}
+
+// TextCharset returns a Charset based on the given golang.org/x/text encoding.
+func TextCharset(e encoding.Encoding) Charset {
+	return textCharset{e}
+}
+
+// textCharset implements a Charset using a golang.org/x/text encoding.
+type textCharset struct {
+	encoding encoding.Encoding
+}
+
+func (c textCharset) NewDecoder(r io.Reader) io.Reader {
+	return c.encoding.NewDecoder().Reader(r)
+}
+
+func (c textCharset) NewEncoder(w io.Writer) io.WriteCloser {
+	return transform.NewWriter(w, c.encoding.NewEncoder())
+}
+
+var (
+	charsetsMutex = &sync.RWMutex{}
+	charsets      = map[string]Charset{
+		"iso-8859-1":   TextCharset(charmap.ISO8859_1),
+		"iso8859-1":    TextCharset(charmap.ISO8859_1),
+		"latin1":       TextCharset(charmap.ISO8859_1),
+		"windows-1252": TextCharset(charmap.Windows1252),
+		"cp1252":       TextCharset(charmap.Windows1252),
+		"utf-16":       TextCharset(unicode.UTF16(unicode.BigEndian, unicode.UseBOM)),
+		"utf-16be":     TextCharset(unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)),
+		"utf-16le":     TextCharset(unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)),
+		"shift_jis":    TextCharset(japanese.ShiftJIS),
+		"sjis":         TextCharset(japanese.ShiftJIS),
+		"windows-31j":  TextCharset(japanese.ShiftJIS),
+	}
+)
+
+// RegisterCharset registers a Charset for the given Content-Type charset name, such as "euc-kr",
+// replacing any charset previously registered with the same name.
+func RegisterCharset(name string, charset Charset) {
+	charsetsMutex.Lock()
+	charsets[strings.ToLower(name)] = charset
+	charsetsMutex.Unlock()
+}
+
+// GetCharset returns the Charset registered for the given charset name, or nil if none.
+func GetCharset(name string) Charset {
+	charsetsMutex.RLock()
+	defer charsetsMutex.RUnlock()
+	return charsets[strings.ToLower(name)]
+}
+
+// isUTF8 reports whether the given charset name is UTF-8 or a subset of it.
+func isUTF8(name string) bool {
+	name = strings.ToLower(name)
+	return name == "" || name == "utf-8" || name == "utf8" || name == "us-ascii"
+}
+
+// contentCharset returns the Charset for the charset parameter of the Content-Type header.
+// It returns a nil Charset for UTF-8 text, and false if the charset is not supported.
+func contentCharset(header http.Header) (Charset, bool) {
+	_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || isUTF8(params["charset"]) {
+		return nil, true
+	}
+	charset := GetCharset(params["charset"])
+	return charset, charset != nil
+}
+
+// decodeText decodes the given text into UTF-8 based on the Content-Type charset.
+// Text with unsupported charsets is returned untouched.
+func decodeText(header http.Header, text []byte) ([]byte, error) {
+	charset, _ := contentCharset(header)
+	if charset == nil || len(text) == 0 {
+		return text, nil
+	}
+	return ioutil.ReadAll(charset.NewDecoder(bytes.NewReader(text)))
+}
+
+// decodeTextReader returns a reader that decodes the given stream into UTF-8 based on the Content-Type charset.
+func decodeTextReader(header http.Header, r io.Reader) io.Reader {
+	if charset, _ := contentCharset(header); charset != nil {
+		return charset.NewDecoder(r)
+	}
+	return r
+}
+
+// encodeText encodes the given UTF-8 text based on the Content-Type charset.
+// If the charset is not supported or cannot represent the text,
+// the text is returned untouched and the Content-Type charset is set to UTF-8.
+func encodeText(header http.Header, text []byte) []byte {
+	charset, ok := contentCharset(header)
+	if charset == nil {
+		if !ok {
+			setCharset(header, "utf-8")
+		}
+		return text
+	}
+
+	buf := &bytes.Buffer{}
+	writer := charset.NewEncoder(buf)
+	if _, err := writer.Write(text); err != nil {
+		setCharset(header, "utf-8")
+		return text
+	}
+	if err := writer.Close(); err != nil {
+		setCharset(header, "utf-8")
+		return text
+	}
+	return buf.Bytes()
+}
+
+// setContentType sets the given media type in the Content-Type header,
+// keeping the charset parameter of the current one.
+func setContentType(header http.Header, mediaType string) {
+	_, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if isUTF8(params["charset"]) {
+		header.Set("Content-Type", mediaType)
+		return
+	}
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": params["charset"]}))
+}
+
+// setCharset sets the charset parameter of the Content-Type header, if present.
+func setCharset(header http.Header, charset string) {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return
+	}
+	params["charset"] = charset
+	header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+}
+
+// xmlCharsetReader returns the XML decoder charset reader for the given Content-Type header.
+// The Content-Type charset takes precedence over the XML declaration, as the text is already decoded.
+// Otherwise the given charset reader is used, or the registered charsets if nil.
+func xmlCharsetReader(header http.Header, charsetReader XMLCharDecoder) XMLCharDecoder {
+	if charset, _ := contentCharset(header); charset != nil {
+		return func(label string, input io.Reader) (io.Reader, error) {
+			return input, nil
+		}
+	}
+	if charsetReader != nil {
+		return charsetReader
+	}
+	return func(label string, input io.Reader) (io.Reader, error) {
+		if isUTF8(label) {
+			return input, nil
+		}
+		if charset := GetCharset(label); charset != nil {
+			return charset.NewDecoder(input), nil
+		}
+		return nil, ErrUnsupportedCharset
+	}
+}
@@ -0,0 +1,117 @@
+package intercept
+
+import (
+	"bytes"
+	"github.com/nbio/st"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/unicode"
+)
+
+func textResponse(contentType string, body []byte) *ResponseModifier {
+	res := &http.Response{Header: http.Header{"Content-Type": {contentType}}, Body: ioutil.NopCloser(bytes.NewReader(body))}
+	return NewResponseModifier(nil, res)
+}
+
+func TestReadStringCharset(t *testing.T) {
+	str, err := textResponse("text/plain; charset=ISO-8859-1", []byte("caf\xe9")).ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "café")
+
+	str, err = textResponse("text/plain; charset=windows-1252", []byte("\x80 5")).ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "€ 5")
+
+	utf16, _ := unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewEncoder().Bytes([]byte("héllo"))
+	str, err = textResponse("text/plain; charset=utf-16", utf16).ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "héllo")
+
+	// Unsupported charsets are read untouched
+	str, err = textResponse("text/plain; charset=x-unknown", []byte("caf\xe9")).ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "caf\xe9")
+}
+
+func TestStringCharset(t *testing.T) {
+	modifier := textResponse("text/plain; charset=windows-1252", nil)
+	modifier.String("café")
+	body, _ := ioutil.ReadAll(modifier.Response.Body)
+	st.Expect(t, body, []byte("caf\xe9"))
+	st.Expect(t, modifier.Header.Get("Content-Type"), "text/plain; charset=windows-1252")
+
+	// Text that cannot be represented is sent as UTF-8
+	modifier = textResponse("text/plain; charset=iso-8859-1", nil)
+	modifier.String("日本")
+	body, _ = ioutil.ReadAll(modifier.Response.Body)
+	st.Expect(t, string(body), "日本")
+	st.Expect(t, modifier.Header.Get("Content-Type"), "text/plain; charset=utf-8")
+}
+
+func TestJSONCharset(t *testing.T) {
+	sjis, _ := japanese.ShiftJIS.NewEncoder().Bytes([]byte(`{"name":"日本"}`))
+	modifier := textResponse("application/json; charset=Shift_JIS", sjis)
+
+	data := map[string]string{}
+	st.Expect(t, modifier.DecodeJSON(&data), nil)
+	st.Expect(t, data["name"], "日本")
+
+	name, err := modifier.JSONGet("/name")
+	st.Expect(t, err, nil)
+	st.Expect(t, name, "日本")
+
+	data["name"] = "東京"
+	st.Expect(t, modifier.JSON(data), nil)
+	st.Expect(t, modifier.Header.Get("Content-Type"), "application/json; charset=Shift_JIS")
+	body, _ := ioutil.ReadAll(modifier.Response.Body)
+	expected, _ := japanese.ShiftJIS.NewEncoder().Bytes([]byte("{\"name\":\"東京\"}\n"))
+	st.Expect(t, body, expected)
+}
+
+func TestDecodeXMLCharset(t *testing.T) {
+	xml := []byte("<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><Person><Name>Jos\xe9</Name></Person>")
+
+	// The XML declaration is decoded using the registered charsets
+	person := &user{}
+	st.Expect(t, textResponse("application/xml", xml).DecodeXML(person, nil), nil)
+	st.Expect(t, person.Name, "José")
+
+	// The Content-Type charset takes precedence
+	person = &user{}
+	st.Expect(t, textResponse("application/xml; charset=iso-8859-1", xml).DecodeXML(person, nil), nil)
+	st.Expect(t, person.Name, "José")
+}
+
+// upperCharset is a test charset that upper cases ASCII letters.
+type upperCharset struct{}
+
+func (upperCharset) NewDecoder(r io.Reader) io.Reader {
+	buf, _ := ioutil.ReadAll(r)
+	return bytes.NewReader(bytes.ToUpper(buf))
+}
+
+func (upperCharset) NewEncoder(w io.Writer) io.WriteCloser {
+	return nopWriteCloser{w}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestRegisterCharset(t *testing.T) {
+	RegisterCharset("X-Upper", upperCharset{})
+	defer RegisterCharset("x-upper", nil)
+	st.Expect(t, GetCharset("x-upper"), Charset(upperCharset{}))
+
+	str, err := textResponse("text/plain; charset=x-upper", []byte("hello")).ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "HELLO")
+}
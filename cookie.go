@@ -0,0 +1,152 @@
+package intercept
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Cookie returns the named cookie sent in the http.Request,
+// or http.ErrNoCookie if not found.
+func (s *RequestModifier) Cookie(name string) (*http.Cookie, error) {
+	return s.Request.Cookie(name)
+}
+
+// Cookies returns the cookies sent in the http.Request.
+func (s *RequestModifier) Cookies() []*http.Cookie {
+	return s.Request.Cookies()
+}
+
+// SetCookie sets the given cookie value in the http.Request, replacing any cookie with the same name.
+func (s *RequestModifier) SetCookie(name, value string) {
+	cookies := s.Request.Cookies()
+	found := false
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			cookie.Value = value
+			found = true
+		}
+	}
+	if !found {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value})
+	}
+	s.setCookies(cookies)
+}
+
+// DeleteCookie removes the named cookie from the http.Request.
+func (s *RequestModifier) DeleteCookie(name string) {
+	var cookies []*http.Cookie
+	for _, cookie := range s.Request.Cookies() {
+		if cookie.Name != name {
+			cookies = append(cookies, cookie)
+		}
+	}
+	s.setCookies(cookies)
+}
+
+// setCookies replaces the Cookie header of the http.Request with the given cookies.
+func (s *RequestModifier) setCookies(cookies []*http.Cookie) {
+	s.Header.Del("Cookie")
+	if len(cookies) == 0 {
+		return
+	}
+
+	pairs := make([]string, len(cookies))
+	for i, cookie := range cookies {
+		pairs[i] = (&http.Cookie{Name: cookie.Name, Value: cookie.Value}).String()
+	}
+	s.Header.Set("Cookie", strings.Join(pairs, "; "))
+}
+
+// Cookies returns the cookies defined by the Set-Cookie headers of the http.Response.
+func (s *ResponseModifier) Cookies() []*http.Cookie {
+	return s.Response.Cookies()
+}
+
+// Cookie returns the named cookie defined by the http.Response, or http.ErrNoCookie if not found.
+func (s *ResponseModifier) Cookie(name string) (*http.Cookie, error) {
+	for _, cookie := range s.Response.Cookies() {
+		if cookie.Name == name {
+			return cookie, nil
+		}
+	}
+	return nil, http.ErrNoCookie
+}
+
+// SetCookie adds the given cookie to the http.Response, replacing any cookie
+// with the same name, domain and path.
+func (s *ResponseModifier) SetCookie(cookie *http.Cookie) {
+	s.EditCookies(func(c *http.Cookie) bool {
+		return c.Name != cookie.Name || !strings.EqualFold(c.Domain, cookie.Domain) || c.Path != cookie.Path
+	})
+	if v := cookie.String(); v != "" {
+		s.Header.Add("Set-Cookie", v)
+	}
+}
+
+// DeleteCookie removes the cookies with the given name from the http.Response.
+func (s *ResponseModifier) DeleteCookie(name string) {
+	s.EditCookies(func(c *http.Cookie) bool {
+		return c.Name != name
+	})
+}
+
+// EditCookies calls the given function with every cookie defined by the http.Response,
+// so its attributes can be modified. Cookies are removed if the function returns false.
+// Unmodified cookies are kept as sent, including any attribute unknown to http.Cookie.
+func (s *ResponseModifier) EditCookies(fn func(*http.Cookie) bool) {
+	lines := s.Header.Values("Set-Cookie")
+	if len(lines) == 0 {
+		return
+	}
+
+	var result []string
+	for _, line := range lines {
+		cookies := (&http.Response{Header: http.Header{"Set-Cookie": {line}}}).Cookies()
+		if len(cookies) == 0 {
+			// Keep invalid cookies untouched
+			result = append(result, line)
+			continue
+		}
+
+		cookie := cookies[0]
+		original := cookie.String()
+		if !fn(cookie) {
+			continue
+		}
+		if v := cookie.String(); v != original {
+			line = v
+		}
+		if line != "" {
+			result = append(result, line)
+		}
+	}
+
+	s.Header.Del("Set-Cookie")
+	for _, line := range result {
+		s.Header.Add("Set-Cookie", line)
+	}
+}
+
+// RewriteCookieDomain replaces the given domain in the Domain attribute of the http.Response cookies,
+// as needed when proxying an upstream server under a different host.
+// An empty replacement removes the Domain attribute, making them host-only cookies.
+func (s *ResponseModifier) RewriteCookieDomain(domain, replacement string) {
+	domain = strings.TrimPrefix(domain, ".")
+	s.EditCookies(func(c *http.Cookie) bool {
+		if strings.EqualFold(strings.TrimPrefix(c.Domain, "."), domain) {
+			c.Domain = replacement
+		}
+		return true
+	})
+}
+
+// RewriteCookiePath replaces the given path prefix in the Path attribute of the http.Response cookies,
+// as needed when proxying an upstream server under a different path prefix.
+func (s *ResponseModifier) RewriteCookiePath(prefix, replacement string) {
+	s.EditCookies(func(c *http.Cookie) bool {
+		if c.Path != "" {
+			c.Path, _ = replacePathPrefix(c.Path, prefix, replacement)
+		}
+		return true
+	})
+}
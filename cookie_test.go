@@ -0,0 +1,107 @@
+package intercept
+
+import (
+	"github.com/nbio/st"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRequestModifierCookies(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	req.Header.Set("Cookie", "session=abc; theme=dark")
+	modifier := NewRequestModifier(req)
+
+	cookie, err := modifier.Cookie("session")
+	st.Expect(t, err, nil)
+	st.Expect(t, cookie.Value, "abc")
+	st.Expect(t, len(modifier.Cookies()), 2)
+
+	_, err = modifier.Cookie("missing")
+	st.Expect(t, err, http.ErrNoCookie)
+
+	modifier.SetCookie("session", "xyz")
+	modifier.SetCookie("lang", "en")
+	st.Expect(t, req.Header.Get("Cookie"), "session=xyz; theme=dark; lang=en")
+
+	modifier.DeleteCookie("theme")
+	st.Expect(t, req.Header.Get("Cookie"), "session=xyz; lang=en")
+
+	modifier.DeleteCookie("session")
+	modifier.DeleteCookie("lang")
+	st.Expect(t, req.Header["Cookie"], []string(nil))
+}
+
+func cookieResponse(cookies ...string) *ResponseModifier {
+	return NewResponseModifier(nil, &http.Response{Header: http.Header{"Set-Cookie": cookies}})
+}
+
+func TestResponseModifierCookies(t *testing.T) {
+	modifier := cookieResponse("session=abc; Path=/; HttpOnly; Priority=High", "theme=dark")
+
+	st.Expect(t, len(modifier.Cookies()), 2)
+	cookie, err := modifier.Cookie("session")
+	st.Expect(t, err, nil)
+	st.Expect(t, cookie.HttpOnly, true)
+
+	_, err = modifier.Cookie("missing")
+	st.Expect(t, err, http.ErrNoCookie)
+
+	modifier.SetCookie(&http.Cookie{Name: "theme", Value: "light", SameSite: http.SameSiteLaxMode})
+	modifier.SetCookie(&http.Cookie{Name: "lang", Value: "en", Path: "/"})
+	st.Expect(t, modifier.Header["Set-Cookie"], []string{
+		"session=abc; Path=/; HttpOnly; Priority=High",
+		"theme=light; SameSite=Lax",
+		"lang=en; Path=/",
+	})
+
+	modifier.DeleteCookie("theme")
+	st.Expect(t, modifier.Header["Set-Cookie"], []string{
+		"session=abc; Path=/; HttpOnly; Priority=High",
+		"lang=en; Path=/",
+	})
+}
+
+func TestResponseModifierEditCookies(t *testing.T) {
+	modifier := cookieResponse("session=abc; Path=/", "theme=dark")
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	modifier.EditCookies(func(c *http.Cookie) bool {
+		if c.Name == "theme" {
+			return false
+		}
+		c.Secure = true
+		c.Expires = expires
+		return true
+	})
+	st.Expect(t, modifier.Header["Set-Cookie"], []string{
+		"session=abc; Path=/; Expires=Tue, 01 Jan 2030 00:00:00 GMT; Secure",
+	})
+}
+
+func TestResponseModifierRewriteCookies(t *testing.T) {
+	modifier := cookieResponse(
+		"a=1; Domain=internal.local; Path=/app/users",
+		"b=2; Domain=.internal.local; Path=/app",
+		"c=3; Domain=other.com; Path=/application",
+		"d=4",
+	)
+
+	modifier.RewriteCookieDomain("internal.local", "example.com")
+	modifier.RewriteCookiePath("/app/", "/public/app")
+	st.Expect(t, modifier.Header["Set-Cookie"], []string{
+		"a=1; Path=/public/app/users; Domain=example.com",
+		"b=2; Path=/public/app; Domain=example.com",
+		"c=3; Domain=other.com; Path=/application",
+		"d=4",
+	})
+
+	modifier.RewriteCookieDomain("example.com", "")
+	modifier.RewriteCookiePath("/public", "/")
+	st.Expect(t, modifier.Header["Set-Cookie"], []string{
+		"a=1; Path=/app/users",
+		"b=2; Path=/app",
+		"c=3; Domain=other.com; Path=/application",
+		"d=4",
+	})
+}
@@ -0,0 +1,200 @@
+package intercept
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ErrUnsupportedEncoding is returned when the message body is encoded
+// with a Content-Encoding that has no registered Codec.
+var ErrUnsupportedEncoding = errors.New("intercept: unsupported content encoding")
+
+// Codec defines the interface implemented by HTTP content codings,
+// used to transparently decode and encode compressed message bodies.
+type Codec interface {
+	// NewReader returns a reader that decodes the given encoded stream.
+	NewReader(r io.Reader) (io.ReadCloser, error)
+
+	// NewWriter returns a writer that encodes and writes data into the given writer.
+	NewWriter(w io.Writer) (io.WriteCloser, error)
+}
+
+// gzipCodec implements the gzip content coding.
+type gzipCodec struct{}
+
+func (gzipCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+func (gzipCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+// deflateCodec implements the deflate content coding.
+type deflateCodec struct{}
+
+func (deflateCodec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	header, err := buf.Peek(2)
+	if err == nil && isZlibHeader(header) {
+		return zlib.NewReader(buf)
+	}
+	// Some servers send raw deflate streams without the zlib wrapper
+	return flate.NewReader(buf), nil
+}
+
+func (deflateCodec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
+// isZlibHeader reports whether the given bytes are a valid zlib stream header.
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
+
+var (
+	codecsMutex = &sync.RWMutex{}
+	codecs      = map[string]Codec{
+		"gzip":    gzipCodec{},
+		"x-gzip":  gzipCodec{},
+		"deflate": deflateCodec{},
+	}
+)
+
+// RegisterCodec registers a Codec for the given Content-Encoding name, such as "br" or "zstd",
+// replacing any codec previously registered with the same name.
+func RegisterCodec(encoding string, codec Codec) {
+	codecsMutex.Lock()
+	codecs[strings.ToLower(encoding)] = codec
+	codecsMutex.Unlock()
+}
+
+// GetCodec returns the Codec registered for the given Content-Encoding name, or nil if none.
+func GetCodec(encoding string) Codec {
+	codecsMutex.RLock()
+	defer codecsMutex.RUnlock()
+	return codecs[strings.ToLower(encoding)]
+}
+
+// contentCodecs returns the codecs for the Content-Encoding header values in the order
+// they were applied. It returns false if any of the encodings is not supported.
+func contentCodecs(header http.Header) ([]Codec, bool) {
+	var list []Codec
+	for _, value := range header["Content-Encoding"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" || strings.EqualFold(name, "identity") {
+				continue
+			}
+			codec := GetCodec(name)
+			if codec == nil {
+				return nil, false
+			}
+			list = append(list, codec)
+		}
+	}
+	return list, true
+}
+
+// decodeBody decodes the given body based on the Content-Encoding header,
+// up to the given size limit of the decoded body if greater than zero.
+// If the decoded body exceeds the limit, a BodyTooLargeError is returned.
+// Bodies with unsupported encodings are returned untouched.
+func decodeBody(header http.Header, body []byte, limit int64) ([]byte, error) {
+	list, ok := contentCodecs(header)
+	if !ok || len(list) == 0 || len(body) == 0 {
+		return body, nil
+	}
+
+	var reader io.Reader = bytes.NewReader(body)
+	for i := len(list) - 1; i >= 0; i-- {
+		rc, err := list[i].NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		reader = rc
+	}
+
+	decoded, err := ioutil.ReadAll(limitReader(reader, limit))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLimit(int64(len(decoded)), limit); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// encodeBody encodes the given body based on the Content-Encoding header.
+func encodeBody(header http.Header, body []byte) ([]byte, error) {
+	list, ok := contentCodecs(header)
+	if !ok {
+		return nil, ErrUnsupportedEncoding
+	}
+
+	for _, codec := range list {
+		buf := &bytes.Buffer{}
+		writer, err := codec.NewWriter(buf)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := writer.Write(body); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+
+	return body, nil
+}
+
+// encodeReader returns a reader that encodes the given stream based on the Content-Encoding header.
+// Closing the reader stops the encoding, and the given stream is closed once consumed if it is an io.Closer.
+// It returns false if the stream does not need to be encoded.
+func encodeReader(header http.Header, body io.Reader) (io.ReadCloser, bool) {
+	list, ok := contentCodecs(header)
+	if !ok || len(list) == 0 {
+		return nil, false
+	}
+
+	reader, pipe := io.Pipe()
+	go func() {
+		if closer, ok := body.(io.Closer); ok {
+			defer closer.Close()
+		}
+
+		var writer io.Writer = pipe
+		var closers []io.Closer
+		for i := len(list) - 1; i >= 0; i-- {
+			w, err := list[i].NewWriter(writer)
+			if err != nil {
+				pipe.CloseWithError(err)
+				return
+			}
+			closers = append(closers, w)
+			writer = w
+		}
+
+		_, err := io.Copy(writer, body)
+		for i := len(closers) - 1; i >= 0; i-- {
+			if cerr := closers[i].Close(); err == nil {
+				err = cerr
+			}
+		}
+		pipe.CloseWithError(err)
+	}()
+
+	return reader, true
+}
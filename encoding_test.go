@@ -0,0 +1,197 @@
+package intercept
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"github.com/nbio/st"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type base64Codec struct{}
+
+func (base64Codec) NewReader(r io.Reader) (io.ReadCloser, error) {
+	return ioutil.NopCloser(base64.NewDecoder(base64.StdEncoding, r)), nil
+}
+
+func (base64Codec) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	return base64.NewEncoder(base64.StdEncoding, w), nil
+}
+
+func gzipBytes(body string) []byte {
+	buf := &bytes.Buffer{}
+	writer := gzip.NewWriter(buf)
+	writer.Write([]byte(body))
+	writer.Close()
+	return buf.Bytes()
+}
+
+func gunzipBytes(t *testing.T, body []byte) string {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
+	st.Assert(t, err, nil)
+	buf, err := ioutil.ReadAll(reader)
+	st.Assert(t, err, nil)
+	return string(buf)
+}
+
+func gzipResponse(body string) *http.Response {
+	buf := gzipBytes(body)
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip")
+	header.Set("Content-Length", "1")
+	return &http.Response{Header: header, Body: ioutil.NopCloser(bytes.NewReader(buf)), ContentLength: int64(len(buf))}
+}
+
+func TestResponseModifierReadGzip(t *testing.T) {
+	resp := gzipResponse(`{"name":"Rick"}`)
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	str, err := modifier.ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, `{"name":"Rick"}`)
+
+	u := user{}
+	err = modifier.DecodeJSON(&u)
+	st.Expect(t, err, nil)
+	st.Expect(t, u.Name, "Rick")
+}
+
+func TestResponseModifierWriteGzip(t *testing.T) {
+	resp := gzipResponse("foo")
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	modifier.String("hello world")
+	body, _ := ioutil.ReadAll(resp.Body)
+	st.Expect(t, gunzipBytes(t, body), "hello world")
+	st.Expect(t, resp.ContentLength, int64(len(body)))
+	st.Expect(t, resp.Header.Get("Content-Length"), strconv.Itoa(len(body)))
+	st.Expect(t, resp.Header.Get("Content-Encoding"), "gzip")
+}
+
+func TestResponseModifierReaderGzip(t *testing.T) {
+	resp := gzipResponse("foo")
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	modifier.Reader(strings.NewReader("hello world"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	st.Expect(t, gunzipBytes(t, body), "hello world")
+	st.Expect(t, resp.ContentLength, int64(-1))
+	st.Expect(t, resp.Header.Get("Content-Length"), "")
+}
+
+type closeNotifier struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (c *closeNotifier) Close() error {
+	close(c.closed)
+	return nil
+}
+
+func TestResponseModifierReaderGzipClose(t *testing.T) {
+	resp := gzipResponse("foo")
+	source := &closeNotifier{io.LimitReader(rand.New(rand.NewSource(1)), 1<<20), make(chan struct{})}
+	NewResponseModifier(&http.Request{}, resp).Reader(source)
+
+	// Closing the body stops the encoding before the stream is consumed
+	st.Expect(t, resp.Body.Close(), nil)
+	select {
+	case <-source.closed:
+	case <-time.After(time.Second):
+		t.Fatal("encoding goroutine still running")
+	}
+}
+
+func TestResponseModifierStripEncoding(t *testing.T) {
+	resp := gzipResponse("hello")
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	err := modifier.StripEncoding()
+	st.Expect(t, err, nil)
+	st.Expect(t, resp.Header.Get("Content-Encoding"), "")
+	st.Expect(t, resp.Header.Get("Content-Length"), "5")
+	modifier.String("bye")
+	body, _ := ioutil.ReadAll(resp.Body)
+	st.Expect(t, string(body), "bye")
+}
+
+func TestResponseModifierUnsupportedEncoding(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Encoding", "unknown")
+	resp := &http.Response{Header: header, Body: ioutil.NopCloser(strings.NewReader("raw"))}
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	str, err := modifier.ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "raw")
+	st.Expect(t, modifier.StripEncoding(), ErrUnsupportedEncoding)
+
+	modifier.String("plain")
+	st.Expect(t, resp.Header.Get("Content-Encoding"), "")
+	body, _ := ioutil.ReadAll(resp.Body)
+	st.Expect(t, string(body), "plain")
+}
+
+func TestRequestModifierGzip(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip")
+	req := &http.Request{Method: "POST", Header: header, Body: ioutil.NopCloser(bytes.NewReader(gzipBytes("foo")))}
+	modifier := NewRequestModifier(req)
+	str, err := modifier.ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, str, "foo")
+
+	modifier.String("bar")
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, gunzipBytes(t, body), "bar")
+	st.Expect(t, req.ContentLength, int64(len(body)))
+}
+
+func TestDeflateCodec(t *testing.T) {
+	zbuf := &bytes.Buffer{}
+	zwriter := zlib.NewWriter(zbuf)
+	zwriter.Write([]byte("zlib"))
+	zwriter.Close()
+
+	fbuf := &bytes.Buffer{}
+	fwriter, _ := flate.NewWriter(fbuf, flate.DefaultCompression)
+	fwriter.Write([]byte("raw"))
+	fwriter.Close()
+
+	header := http.Header{}
+	header.Set("Content-Encoding", "deflate")
+	body, err := decodeBody(header, zbuf.Bytes(), 0)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "zlib")
+	body, err = decodeBody(header, fbuf.Bytes(), 0)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), "raw")
+}
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec("B64", base64Codec{})
+	st.Expect(t, GetCodec("b64"), Codec(base64Codec{}))
+
+	header := http.Header{}
+	header.Set("Content-Encoding", "gzip, b64")
+	encoded, err := encodeBody(header, []byte("hello"))
+	st.Expect(t, err, nil)
+	gzipped, _ := base64.StdEncoding.DecodeString(string(encoded))
+	st.Expect(t, gunzipBytes(t, gzipped), "hello")
+
+	decoded, err := decodeBody(header, encoded, 0)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(decoded), "hello")
+
+	reader, ok := encodeReader(header, strings.NewReader("hello"))
+	st.Expect(t, ok, true)
+	streamed, _ := ioutil.ReadAll(reader)
+	decoded, err = decodeBody(header, streamed, 0)
+	st.Expect(t, err, nil)
+	st.Expect(t, string(decoded), "hello")
+}
@@ -0,0 +1,50 @@
+package intercept
+
+import (
+	"log"
+	"net/http"
+)
+
+// ErrorHandler defines the function interface used to handle errors returned by modifier functions.
+// It returns true if the error has been handled by replying to the client,
+// or false to fall back to the unmodified HTTP message.
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, err error) bool
+
+// DefaultErrorHandler is used when no error handler is configured in the interceptor.
+// It replies with an Internal Server Error response.
+var DefaultErrorHandler = ErrorStatus(http.StatusInternalServerError)
+
+// ErrorStatus returns an ErrorHandler that replies with the given status code.
+func ErrorStatus(status int) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) bool {
+		http.Error(w, http.StatusText(status), status)
+		return true
+	}
+}
+
+// ErrorLogger returns an ErrorHandler that logs the error using the given logger
+// and falls back to the unmodified HTTP message.
+// If logger is nil, the standard logger is used.
+func ErrorLogger(logger *log.Logger) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, err error) bool {
+		if logger == nil {
+			log.Printf("intercept: %s %s: %s", r.Method, r.URL, err)
+		} else {
+			logger.Printf("intercept: %s %s: %s", r.Method, r.URL, err)
+		}
+		return false
+	}
+}
+
+// ErrorFallback is an ErrorHandler that silently falls back to the unmodified HTTP message.
+func ErrorFallback(w http.ResponseWriter, r *http.Request, err error) bool {
+	return false
+}
+
+// handleError calls the given error handler, or the default one if nil.
+func handleError(handler ErrorHandler, w http.ResponseWriter, r *http.Request, err error) bool {
+	if handler == nil {
+		handler = DefaultErrorHandler
+	}
+	return handler(w, r, err)
+}
@@ -0,0 +1,36 @@
+package intercept
+
+import (
+	"bytes"
+	"errors"
+	"github.com/nbio/st"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var errModifier = errors.New("modifier error")
+
+func TestErrorStatus(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	handled := ErrorStatus(400)(recorder, &http.Request{}, errModifier)
+	st.Expect(t, handled, true)
+	st.Expect(t, recorder.Code, 400)
+	st.Expect(t, strings.TrimSpace(recorder.Body.String()), "Bad Request")
+}
+
+func TestErrorLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	req, _ := http.NewRequest("GET", "/foo", nil)
+	recorder := httptest.NewRecorder()
+	handled := ErrorLogger(log.New(buf, "", 0))(recorder, req, errModifier)
+	st.Expect(t, handled, false)
+	st.Expect(t, buf.String(), "intercept: GET /foo: modifier error\n")
+	st.Expect(t, recorder.Body.Len(), 0)
+}
+
+func TestErrorFallback(t *testing.T) {
+	st.Expect(t, ErrorFallback(nil, nil, errModifier), false)
+}
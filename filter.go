@@ -0,0 +1,248 @@
+package intercept
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Method filters requests whose HTTP method is any of the given ones.
+func Method(methods ...string) Filter {
+	return func(r *http.Request) bool {
+		for _, method := range methods {
+			if strings.EqualFold(r.Method, method) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Path filters requests whose URL path matches the given route pattern, such as "/users/:id/*file".
+// Segments starting with ":" match any path segment, and a final segment starting with "*"
+// matches the rest of the path. Matched parameters are defined as request path values,
+// accessible from the request modifier via RequestModifier.Param.
+func Path(pattern string) Filter {
+	segments := strings.Split(strings.Trim(pattern, "/"), "/")
+	return func(r *http.Request) bool {
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		params := make(map[string]string)
+
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, "*") && i == len(segments)-1 {
+				if name := segment[1:]; name != "" {
+					params[name] = strings.Join(parts[min(i, len(parts)):], "/")
+				}
+				return setPathValues(r, params)
+			}
+			if i >= len(parts) {
+				return false
+			}
+			if strings.HasPrefix(segment, ":") && parts[i] != "" {
+				params[segment[1:]] = parts[i]
+				continue
+			}
+			if segment != parts[i] {
+				return false
+			}
+		}
+
+		if len(parts) != len(segments) {
+			return false
+		}
+		return setPathValues(r, params)
+	}
+}
+
+// PathPrefix filters requests whose URL path starts with the given prefix.
+func PathPrefix(prefix string) Filter {
+	return func(r *http.Request) bool {
+		return strings.HasPrefix(r.URL.Path, prefix)
+	}
+}
+
+// PathRegexp filters requests whose URL path matches the given regular expression.
+// Named capture groups are defined as request path values, accessible from the
+// request modifier via RequestModifier.Param. It panics if the expression cannot be parsed.
+func PathRegexp(pattern string) Filter {
+	re := regexp.MustCompile(pattern)
+	return func(r *http.Request) bool {
+		match := re.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			return false
+		}
+
+		params := make(map[string]string)
+		for i, name := range re.SubexpNames() {
+			if name != "" {
+				params[name] = match[i]
+			}
+		}
+		return setPathValues(r, params)
+	}
+}
+
+// Host filters requests whose host is any of the given ones.
+// The port is only compared if defined in the given host.
+func Host(hosts ...string) Filter {
+	return func(r *http.Request) bool {
+		host := r.Host
+		if host == "" && r.URL != nil {
+			host = r.URL.Host
+		}
+
+		for _, h := range hosts {
+			if strings.EqualFold(host, h) {
+				return true
+			}
+			if !strings.Contains(h, ":") && strings.EqualFold(stripPort(host), h) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// HeaderEquals filters requests whose header field is equal to the given value.
+func HeaderEquals(key, value string) Filter {
+	return func(r *http.Request) bool {
+		return r.Header.Get(key) == value
+	}
+}
+
+// HeaderMatches filters requests whose header field matches the given regular expression.
+// It panics if the expression cannot be parsed.
+func HeaderMatches(key, pattern string) Filter {
+	re := regexp.MustCompile(pattern)
+	return func(r *http.Request) bool {
+		return re.MatchString(r.Header.Get(key))
+	}
+}
+
+// QueryHas filters requests whose URL query defines the given parameter.
+func QueryHas(key string) Filter {
+	return func(r *http.Request) bool {
+		_, ok := r.URL.Query()[key]
+		return ok
+	}
+}
+
+// ContentType filters requests whose Content-Type media type matches any of the given ones.
+// Wildcard subtypes, such as "text/*", are supported.
+func ContentType(types ...string) Filter {
+	return func(r *http.Request) bool {
+		return matchMediaType(r.Header.Get("Content-Type"), types)
+	}
+}
+
+// And filters requests matching all the given filters.
+func And(filters ...Filter) Filter {
+	return func(r *http.Request) bool {
+		for _, filter := range filters {
+			if !filter(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Or filters requests matching any of the given filters.
+func Or(filters ...Filter) Filter {
+	return func(r *http.Request) bool {
+		for _, filter := range filters {
+			if filter(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Not filters requests not matching the given filter.
+func Not(filter Filter) Filter {
+	return func(r *http.Request) bool {
+		return !filter(r)
+	}
+}
+
+// ResStatus filters responses whose status code is any of the given ones.
+func ResStatus(codes ...int) ResFilter {
+	return func(res *http.Response) bool {
+		for _, code := range codes {
+			if res.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ResStatusRange filters responses whose status code is within the given inclusive range.
+func ResStatusRange(min, max int) ResFilter {
+	return func(res *http.Response) bool {
+		return res.StatusCode >= min && res.StatusCode <= max
+	}
+}
+
+// ResContentType filters responses whose Content-Type media type matches any of the given ones.
+// Wildcard subtypes, such as "text/*", are supported.
+func ResContentType(types ...string) ResFilter {
+	return func(res *http.Response) bool {
+		return matchMediaType(res.Header.Get("Content-Type"), types)
+	}
+}
+
+// ResHasHeader filters responses which define the given header field.
+func ResHasHeader(key string) ResFilter {
+	return func(res *http.Response) bool {
+		_, ok := res.Header[http.CanonicalHeaderKey(key)]
+		return ok
+	}
+}
+
+// ResMaxBodySize filters responses whose announced Content-Length is lower or equal than the given size.
+// Responses with an unknown body length, such as chunked ones, are filtered out.
+func ResMaxBodySize(size int64) ResFilter {
+	return func(res *http.Response) bool {
+		return res.ContentLength >= 0 && res.ContentLength <= size
+	}
+}
+
+// matchMediaType reports whether the media type of the given Content-Type header value
+// matches any of the given media types.
+func matchMediaType(value string, types []string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	if err != nil {
+		return false
+	}
+
+	for _, t := range types {
+		t = strings.ToLower(t)
+		if t == mediaType || t == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// setPathValues defines the given parameters as request path values.
+// It always returns true, so it can be used as the filter result.
+func setPathValues(r *http.Request, params map[string]string) bool {
+	for name, value := range params {
+		r.SetPathValue(name, value)
+	}
+	return true
+}
+
+// stripPort removes the port, if any, from the given host.
+func stripPort(host string) string {
+	if i := strings.LastIndex(host, ":"); i != -1 && !strings.HasSuffix(host, "]") {
+		return strings.Trim(host[:i], "[]")
+	}
+	return strings.Trim(host, "[]")
+}
@@ -0,0 +1,130 @@
+package intercept
+
+import (
+	"github.com/nbio/st"
+	"net/http"
+	"testing"
+)
+
+func newFilterRequest(method, target string) *http.Request {
+	req, _ := http.NewRequest(method, target, nil)
+	return req
+}
+
+func TestMethod(t *testing.T) {
+	filter := Method("GET", "post")
+	st.Expect(t, filter(newFilterRequest("POST", "/")), true)
+	st.Expect(t, filter(newFilterRequest("DELETE", "/")), false)
+}
+
+func TestPath(t *testing.T) {
+	filter := Path("/users/:id/files/*file")
+	req := newFilterRequest("GET", "/users/123/files/docs/a.txt")
+	st.Expect(t, filter(req), true)
+	st.Expect(t, req.PathValue("id"), "123")
+	st.Expect(t, req.PathValue("file"), "docs/a.txt")
+	st.Expect(t, filter(newFilterRequest("GET", "/users/123/photos/a.png")), false)
+
+	filter = Path("/users/:id")
+	req = newFilterRequest("GET", "/users/123")
+	st.Expect(t, filter(req), true)
+	st.Expect(t, NewRequestModifier(req).Param("id"), "123")
+	st.Expect(t, filter(newFilterRequest("GET", "/users")), false)
+	st.Expect(t, filter(newFilterRequest("GET", "/users/123/files")), false)
+}
+
+func TestPathPrefix(t *testing.T) {
+	filter := PathPrefix("/api/")
+	st.Expect(t, filter(newFilterRequest("GET", "/api/users")), true)
+	st.Expect(t, filter(newFilterRequest("GET", "/apis")), false)
+}
+
+func TestPathRegexp(t *testing.T) {
+	filter := PathRegexp(`^/users/(?P<id>\d+)$`)
+	req := newFilterRequest("GET", "/users/42")
+	st.Expect(t, filter(req), true)
+	st.Expect(t, req.PathValue("id"), "42")
+	st.Expect(t, filter(newFilterRequest("GET", "/users/rick")), false)
+}
+
+func TestHost(t *testing.T) {
+	filter := Host("example.com", "api.example.com:8080")
+	st.Expect(t, filter(newFilterRequest("GET", "http://example.com/")), true)
+	st.Expect(t, filter(newFilterRequest("GET", "http://EXAMPLE.com:3000/")), true)
+	st.Expect(t, filter(newFilterRequest("GET", "http://api.example.com:8080/")), true)
+	st.Expect(t, filter(newFilterRequest("GET", "http://api.example.com/")), false)
+}
+
+func TestHeaderFilters(t *testing.T) {
+	req := newFilterRequest("GET", "/")
+	req.Header.Set("Authorization", "Bearer token")
+	st.Expect(t, HeaderEquals("Authorization", "Bearer token")(req), true)
+	st.Expect(t, HeaderEquals("Authorization", "Basic")(req), false)
+	st.Expect(t, HeaderMatches("Authorization", "^Bearer ")(req), true)
+	st.Expect(t, HeaderMatches("Authorization", "^Basic ")(req), false)
+}
+
+func TestQueryHas(t *testing.T) {
+	filter := QueryHas("debug")
+	st.Expect(t, filter(newFilterRequest("GET", "/?debug")), true)
+	st.Expect(t, filter(newFilterRequest("GET", "/?foo=bar")), false)
+}
+
+func TestContentType(t *testing.T) {
+	req := newFilterRequest("POST", "/")
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	st.Expect(t, ContentType("application/json")(req), true)
+	st.Expect(t, ContentType("application/xml")(req), false)
+}
+
+func TestCombinators(t *testing.T) {
+	yes := func(r *http.Request) bool { return true }
+	no := func(r *http.Request) bool { return false }
+	req := newFilterRequest("GET", "/")
+	st.Expect(t, And(yes, yes)(req), true)
+	st.Expect(t, And(yes, no)(req), false)
+	st.Expect(t, Or(no, yes)(req), true)
+	st.Expect(t, Or(no, no)(req), false)
+	st.Expect(t, Not(no)(req), true)
+	st.Expect(t, And(Method("GET"), Not(PathPrefix("/admin")))(req), true)
+}
+
+func TestResStatus(t *testing.T) {
+	filter := ResStatus(200, 201)
+	st.Expect(t, filter(&http.Response{StatusCode: 201}), true)
+	st.Expect(t, filter(&http.Response{StatusCode: 404}), false)
+}
+
+func TestResStatusRange(t *testing.T) {
+	filter := ResStatusRange(200, 299)
+	st.Expect(t, filter(&http.Response{StatusCode: 200}), true)
+	st.Expect(t, filter(&http.Response{StatusCode: 299}), true)
+	st.Expect(t, filter(&http.Response{StatusCode: 302}), false)
+}
+
+func TestResContentType(t *testing.T) {
+	filter := ResContentType("application/json", "text/*")
+	header := http.Header{}
+	header.Set("Content-Type", "application/json; charset=utf-8")
+	st.Expect(t, filter(&http.Response{Header: header}), true)
+	header.Set("Content-Type", "text/html")
+	st.Expect(t, filter(&http.Response{Header: header}), true)
+	header.Set("Content-Type", "image/png")
+	st.Expect(t, filter(&http.Response{Header: header}), false)
+	st.Expect(t, filter(&http.Response{Header: http.Header{}}), false)
+}
+
+func TestResHasHeader(t *testing.T) {
+	filter := ResHasHeader("x-foo")
+	header := http.Header{}
+	st.Expect(t, filter(&http.Response{Header: header}), false)
+	header.Set("X-Foo", "")
+	st.Expect(t, filter(&http.Response{Header: header}), true)
+}
+
+func TestResMaxBodySize(t *testing.T) {
+	filter := ResMaxBodySize(10)
+	st.Expect(t, filter(&http.Response{ContentLength: 10}), true)
+	st.Expect(t, filter(&http.Response{ContentLength: 11}), false)
+	st.Expect(t, filter(&http.Response{ContentLength: -1}), false)
+}
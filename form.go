@@ -0,0 +1,233 @@
+package intercept
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DecodeForm reads and parses the current http.Request body as an URL-encoded form.
+func (s *RequestModifier) DecodeForm() (url.Values, error) {
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(buf))
+}
+
+// Form sets the given values as URL-encoded http.Request body
+// defining the proper content type header.
+func (s *RequestModifier) Form(values url.Values) {
+	s.Bytes([]byte(values.Encode()))
+	s.Request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+}
+
+// Multipart returns a MultipartEditor to add, remove or replace fields and file parts
+// of the current multipart/form-data http.Request body.
+func (s *RequestModifier) Multipart() (*MultipartEditor, error) {
+	mediaType, params, err := mime.ParseMediaType(s.Request.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		return nil, http.ErrNotMultipart
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, http.ErrMissingBoundary
+	}
+
+	return &MultipartEditor{modifier: s, boundary: boundary, removed: make(map[string]bool)}, nil
+}
+
+// multipartPart represents a part to be added to a multipart body.
+type multipartPart struct {
+	name   string
+	header textproto.MIMEHeader
+	body   io.Reader
+}
+
+// MultipartEditor implements a streaming editor for multipart/form-data request bodies.
+// Changes are applied calling Apply, which regenerates the body boundary and length.
+type MultipartEditor struct {
+	boundary string
+	modifier *RequestModifier
+	removed  map[string]bool
+	parts    []multipartPart
+}
+
+// AddField adds a new form field with the given value.
+func (e *MultipartEditor) AddField(name, value string) {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+	e.parts = append(e.parts, multipartPart{name: name, header: header, body: strings.NewReader(value)})
+}
+
+// SetField replaces any form field or file part with the given name by a new field with the given value.
+func (e *MultipartEditor) SetField(name, value string) {
+	e.Remove(name)
+	e.AddField(name, value)
+}
+
+// AddFile adds a new file part with the given field name and file name,
+// streaming its content from the given reader when the changes are applied.
+// If the reader implements io.Closer, it is closed once consumed.
+func (e *MultipartEditor) AddFile(name, filename string, r io.Reader) {
+	contentType := mime.TypeByExtension(filepath.Ext(filename))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(name), escapeQuotes(filename)))
+	header.Set("Content-Type", contentType)
+	e.parts = append(e.parts, multipartPart{name: name, header: header, body: r})
+}
+
+// SetFile replaces any form field or file part with the given name by a new file part.
+func (e *MultipartEditor) SetFile(name, filename string, r io.Reader) {
+	e.Remove(name)
+	e.AddFile(name, filename, r)
+}
+
+// Remove removes any form field or file part with the given name.
+func (e *MultipartEditor) Remove(name string) {
+	e.removed[name] = true
+
+	parts := e.parts[:0]
+	for _, part := range e.parts {
+		if part.name != name {
+			parts = append(parts, part)
+		}
+	}
+	e.parts = parts
+}
+
+// Apply writes the edited multipart body, streaming the original and added parts
+// through a temporary file, and sets it as http.Request body with a new boundary
+// and the proper content length. The temporary file is removed when the body is closed
+// or the request is done. On error, the original body is kept unmodified.
+func (e *MultipartEditor) Apply() error {
+	file, err := ioutil.TempFile("", "intercept-multipart-")
+	if err != nil {
+		return err
+	}
+	body := &tempFileBody{File: file}
+
+	// Record the consumed original body, so it can be restored on error
+	req := e.modifier.Request
+	original := req.Body
+	consumed := newSpillBuffer(e.modifier.Context(), e.modifier.body.threshold)
+
+	length, contentType, err := e.write(file, original, consumed)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		body.Close()
+		if original != nil {
+			req.Body = restoreBody(consumed, original)
+		}
+		return err
+	}
+
+	consumed.Close()
+	if original != nil {
+		original.Close()
+	}
+	context.AfterFunc(e.modifier.Context(), func() { body.Close() })
+
+	req.Body = body
+	req.GetBody = nil
+	req.ContentLength = length
+	req.TransferEncoding = nil
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Length", strconv.FormatInt(length, 10))
+	req.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+// write writes the edited multipart body into the given file, recording the bytes read
+// from the original body, and returns the body length and content type.
+func (e *MultipartEditor) write(file *os.File, body io.Reader, consumed io.Writer) (int64, string, error) {
+	writer := multipart.NewWriter(file)
+
+	if body != nil {
+		reader := multipart.NewReader(io.TeeReader(body, consumed), e.boundary)
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, "", err
+			}
+			if e.removed[part.FormName()] {
+				continue
+			}
+			if err := copyPart(writer, part.Header, part); err != nil {
+				return 0, "", err
+			}
+		}
+	}
+
+	for _, part := range e.parts {
+		err := copyPart(writer, part.header, part.body)
+		if closer, ok := part.body.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, "", err
+	}
+
+	length, err := file.Seek(0, io.SeekCurrent)
+	return length, writer.FormDataContentType(), err
+}
+
+// copyPart writes a new part with the given header and body in the multipart writer.
+func copyPart(writer *multipart.Writer, header textproto.MIMEHeader, body io.Reader) error {
+	w, err := writer.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, body)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes quotes and backslashes in Content-Disposition parameters.
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// tempFileBody implements an http body backed by a temporary file,
+// which is removed when the body is closed.
+type tempFileBody struct {
+	*os.File
+	once sync.Once
+}
+
+// Close closes and removes the temporary file.
+func (f *tempFileBody) Close() error {
+	var err error
+	f.once.Do(func() {
+		err = f.File.Close()
+		os.Remove(f.File.Name())
+	})
+	return err
+}
@@ -0,0 +1,156 @@
+package intercept
+
+import (
+	"bytes"
+	"context"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func multipartRequest(t *testing.T) *http.Request {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	writer.WriteField("name", "Rick")
+	writer.WriteField("token", "secret")
+	file, _ := writer.CreateFormFile("avatar", "rick.png")
+	file.Write([]byte("image"))
+	writer.Close()
+
+	req, err := http.NewRequest("POST", "/", buf)
+	st.Assert(t, err, nil)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func TestDecodeForm(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("name=Rick&age=70"))
+	modifier := NewRequestModifier(req)
+	values, err := modifier.DecodeForm()
+	st.Expect(t, err, nil)
+	st.Expect(t, values.Get("name"), "Rick")
+	st.Expect(t, values.Get("age"), "70")
+}
+
+func TestDecodeFormError(t *testing.T) {
+	req := &http.Request{Body: ioutil.NopCloser(&errorReader{})}
+	modifier := NewRequestModifier(req)
+	_, err := modifier.DecodeForm()
+	st.Expect(t, err, errRead)
+}
+
+func TestForm(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("name=Rick"))
+	modifier := NewRequestModifier(req)
+	modifier.Form(url.Values{"name": {"Morty"}})
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), "name=Morty")
+	st.Expect(t, req.ContentLength, int64(10))
+	st.Expect(t, req.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+}
+
+func TestMultipart(t *testing.T) {
+	req := multipartRequest(t)
+	oldContentType := req.Header.Get("Content-Type")
+	modifier := NewRequestModifier(req)
+	editor, err := modifier.Multipart()
+	st.Assert(t, err, nil)
+
+	editor.Remove("token")
+	editor.SetField("name", "Morty")
+	editor.AddField("age", "14")
+	editor.SetFile("avatar", "morty.txt", ioutil.NopCloser(strings.NewReader("text")))
+	st.Assert(t, editor.Apply(), nil)
+
+	st.Expect(t, req.Header.Get("Content-Type") != oldContentType, true)
+	st.Expect(t, req.Header.Get("Content-Length"), strconv.FormatInt(req.ContentLength, 10))
+
+	body, _ := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	st.Expect(t, int64(len(body)), req.ContentLength)
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	err = req.ParseMultipartForm(1024)
+	st.Assert(t, err, nil)
+	st.Expect(t, req.MultipartForm.Value["name"], []string{"Morty"})
+	st.Expect(t, req.MultipartForm.Value["age"], []string{"14"})
+	st.Expect(t, len(req.MultipartForm.Value["token"]), 0)
+
+	files := req.MultipartForm.File["avatar"]
+	st.Assert(t, len(files), 1)
+	st.Expect(t, files[0].Filename, "morty.txt")
+	st.Expect(t, files[0].Header.Get("Content-Type"), "text/plain; charset=utf-8")
+	file, _ := files[0].Open()
+	content, _ := ioutil.ReadAll(file)
+	st.Expect(t, string(content), "text")
+}
+
+func TestMultipartKeepsParts(t *testing.T) {
+	req := multipartRequest(t)
+	editor, err := NewRequestModifier(req).Multipart()
+	st.Assert(t, err, nil)
+	st.Assert(t, editor.Apply(), nil)
+	defer req.Body.Close()
+
+	err = req.ParseMultipartForm(1024)
+	st.Assert(t, err, nil)
+	st.Expect(t, req.MultipartForm.Value["name"], []string{"Rick"})
+	st.Expect(t, req.MultipartForm.Value["token"], []string{"secret"})
+	st.Expect(t, req.MultipartForm.File["avatar"][0].Filename, "rick.png")
+}
+
+func TestMultipartInvalidContentType(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("name=Rick"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	_, err := NewRequestModifier(req).Multipart()
+	st.Expect(t, err, http.ErrNotMultipart)
+
+	req.Header.Set("Content-Type", "multipart/form-data")
+	_, err = NewRequestModifier(req).Multipart()
+	st.Expect(t, err, http.ErrMissingBoundary)
+}
+
+func TestMultipartApplyError(t *testing.T) {
+	req := multipartRequest(t)
+	original, _ := ioutil.ReadAll(req.Body)
+
+	// Malformed original body
+	req.Body = ioutil.NopCloser(bytes.NewReader(original[:len(original)-10]))
+	editor, err := NewRequestModifier(req).Multipart()
+	st.Assert(t, err, nil)
+	st.Reject(t, editor.Apply(), nil)
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), string(original[:len(original)-10]))
+
+	// Failing added part
+	req.Body = ioutil.NopCloser(bytes.NewReader(original))
+	editor, _ = NewRequestModifier(req).Multipart()
+	editor.AddFile("upload", "file.txt", &errorReader{})
+	st.Expect(t, editor.Apply(), errRead)
+	body, _ = ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), string(original))
+}
+
+func TestMultipartRequestDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := multipartRequest(t).WithContext(ctx)
+	editor, _ := NewRequestModifier(req).Multipart()
+	st.Assert(t, editor.Apply(), nil)
+
+	name := req.Body.(*tempFileBody).Name()
+	_, err := os.Stat(name)
+	st.Expect(t, err, nil)
+
+	cancel()
+	for i := 0; i < 100 && err == nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+		_, err = os.Stat(name)
+	}
+	st.Expect(t, os.IsNotExist(err), true)
+}
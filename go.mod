@@ -0,0 +1,11 @@
+module gopkg.in/vinxi/intercept.v0
+
+go 1.22
+
+require (
+	github.com/andybalholm/cascadia v1.3.3
+	github.com/nbio/st v0.0.0-20140626010706-e9e8d9816f32
+	golang.org/x/net v0.33.0
+	golang.org/x/text v0.21.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -0,0 +1,623 @@
+package intercept
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// HARRedacted is the value used to replace redacted HAR data.
+const HARRedacted = "REDACTED"
+
+// HAR represents an HTTP Archive 1.2 document.
+type HAR struct {
+	Log *HARLog `json:"log"`
+}
+
+// HARLog represents the root log of an HTTP Archive.
+type HARLog struct {
+	Version string      `json:"version"`
+	Creator *HARCreator `json:"creator"`
+	Entries []*HAREntry `json:"entries"`
+}
+
+// HARCreator represents the application that created the HTTP Archive.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry represents a captured request and response pair.
+type HAREntry struct {
+	StartedDateTime string       `json:"startedDateTime"`
+	Time            float64      `json:"time"`
+	Request         *HARRequest  `json:"request"`
+	Response        *HARResponse `json:"response"`
+	Cache           struct{}     `json:"cache"`
+	Timings         *HARTimings  `json:"timings"`
+	Comment         string       `json:"comment,omitempty"`
+}
+
+// HARRequest represents a captured request.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+// HARResponse represents a captured response.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int64          `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+	Comment     string         `json:"comment,omitempty"`
+}
+
+// HARCookie represents a captured cookie.
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// HARNameValue represents a captured header field or query parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData represents a captured request body.
+// Binary bodies are base64 encoded, as response contents are.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARContent represents a captured response body.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings represents the time spent in each phase of a captured request, in milliseconds.
+// Send is the time spent reading the request body, Wait the time spent by the next handler,
+// and Receive the time spent writing the response to the client.
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// harBodyHashPrefix prefixes the SHA-256 hash of the captured request bodies,
+// stored as post data comment.
+const harBodyHashPrefix = "sha256:"
+
+// harNotCaptured prefixes the comment of the requests and responses whose body was not captured.
+const harNotCaptured = "body not captured"
+
+// HARRedactor defines the function interface used to remove sensitive data from captured entries.
+type HARRedactor func(entry *HAREntry)
+
+// RedactHeaders returns a HARRedactor that replaces the values of the given request
+// and response header fields. Redacting the Cookie or Set-Cookie headers also redacts the cookies.
+func RedactHeaders(names ...string) HARRedactor {
+	return func(entry *HAREntry) {
+		for _, name := range names {
+			redactHeaders(entry.Request.Headers, name)
+			redactHeaders(entry.Response.Headers, name)
+			if strings.EqualFold(name, "Cookie") {
+				redactCookies(entry.Request.Cookies)
+			}
+			if strings.EqualFold(name, "Set-Cookie") {
+				redactCookies(entry.Response.Cookies)
+			}
+		}
+	}
+}
+
+// RedactJSON returns a HARRedactor that replaces the values at the given paths of
+// the captured request and response JSON bodies, using the JSONGet path syntax.
+func RedactJSON(paths ...string) HARRedactor {
+	redact := func(text string) string {
+		buf, err := transformJSON([]byte(text), func(doc interface{}) (interface{}, error) {
+			for _, path := range paths {
+				tokens, err := parseJSONPath(path)
+				if err != nil {
+					return nil, err
+				}
+				if _, err := jsonGet(doc, tokens); err == nil {
+					doc, _ = jsonReplace(doc, tokens, HARRedacted)
+				}
+			}
+			return doc, nil
+		})
+		if err != nil {
+			return text
+		}
+		return string(buf)
+	}
+
+	return func(entry *HAREntry) {
+		if data := entry.Request.PostData; data != nil && data.Encoding == "" && matchMediaType(data.MimeType, []string{"application/json"}) {
+			data.Text = redact(data.Text)
+		}
+		if content := &entry.Response.Content; content.Encoding == "" && matchMediaType(content.MimeType, []string{"application/json"}) {
+			content.Text = redact(content.Text)
+		}
+	}
+}
+
+func redactHeaders(headers []HARNameValue, name string) {
+	for i := range headers {
+		if strings.EqualFold(headers[i].Name, name) {
+			headers[i].Value = HARRedacted
+		}
+	}
+}
+
+func redactCookies(cookies []HARCookie) {
+	for i := range cookies {
+		cookies[i].Value = HARRedacted
+	}
+}
+
+// HARSink defines the interface used to store captured HAR entries.
+type HARSink interface {
+	WriteEntry(entry *HAREntry) error
+}
+
+// HARWriter implements a HARSink that streams the entries as a HAR document into an io.Writer.
+// The document is completed when the writer is closed.
+type HARWriter struct {
+	mutex   sync.Mutex
+	writer  io.Writer
+	started bool
+	closed  bool
+}
+
+// NewHARWriter creates a new HAR writer that writes into the given io.Writer.
+func NewHARWriter(w io.Writer) *HARWriter {
+	return &HARWriter{writer: w}
+}
+
+// WriteEntry writes the given entry in the HAR document.
+func (w *HARWriter) WriteEntry(entry *HAREntry) error {
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+
+	separator := ",\n"
+	if !w.started {
+		separator = harHeader()
+		w.started = true
+	}
+	_, err = w.writer.Write(append([]byte(separator), buf...))
+	return err
+}
+
+// Close completes the HAR document. The underlying io.Writer is not closed.
+func (w *HARWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	footer := "\n]}}\n"
+	if !w.started {
+		footer = harHeader() + footer
+	}
+	_, err := io.WriteString(w.writer, footer)
+	return err
+}
+
+func harHeader() string {
+	return `{"log":{"version":"1.2","creator":{"name":"vinxi/intercept","version":"0.1.0"},"entries":[` + "\n"
+}
+
+// harRotationFormat defines the time format of the rotated HAR file names.
+const harRotationFormat = "20060102T150405.000000000"
+
+// HARFile implements a HARSink that writes the entries into a HAR file,
+// rotating it when it reaches the given maximum size in bytes or number of entries.
+// Rotated files are renamed with the rotation time in nanoseconds as suffix,
+// e.g: capture-20160102T150405.000000000.har.
+type HARFile struct {
+	mutex      sync.Mutex
+	path       string
+	maxSize    int64
+	maxEntries int
+	size       int64
+	entries    int
+	file       *os.File
+	writer     *HARWriter
+}
+
+// NewHARFile creates the given HAR file, which will be rotated when reaching the given
+// maximum size in bytes or number of entries. Zero values disable the rotation limits.
+func NewHARFile(path string, maxSize int64, maxEntries int) (*HARFile, error) {
+	f := &HARFile{path: path, maxSize: maxSize, maxEntries: maxEntries}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// WriteEntry writes the given entry in the current HAR file, rotating it if required.
+func (f *HARFile) WriteEntry(entry *HAREntry) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return os.ErrClosed
+	}
+
+	if f.entries > 0 && ((f.maxSize > 0 && f.size >= f.maxSize) || (f.maxEntries > 0 && f.entries >= f.maxEntries)) {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+
+	f.entries++
+	return f.writer.WriteEntry(entry)
+}
+
+// Close completes and closes the current HAR file.
+func (f *HARFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.close()
+	f.file = nil
+	return err
+}
+
+func (f *HARFile) open() error {
+	file, err := os.Create(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.size = 0
+	f.entries = 0
+	f.writer = NewHARWriter(&countingWriter{writer: file, count: &f.size})
+	return nil
+}
+
+func (f *HARFile) close() error {
+	err := f.writer.Close()
+	if cerr := f.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// rotate completes the current HAR file, renames it and opens a new one.
+func (f *HARFile) rotate() error {
+	if err := f.close(); err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(f.path)
+	rotated := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(f.path, ext), time.Now().Format(harRotationFormat), ext)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// countingWriter counts the bytes written in the underlying io.Writer.
+type countingWriter struct {
+	writer io.Writer
+	count  *int64
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.writer.Write(b)
+	*w.count += int64(n)
+	return n, err
+}
+
+// HARCapture captures the intercepted requests and responses, including their bodies and timings,
+// writing them as HTTP Archive 1.2 entries in the given sink.
+type HARCapture struct {
+	// Sink stores the captured entries.
+	Sink HARSink
+
+	// MaxBodySize defines the maximum body size captured, in bytes.
+	// Larger bodies are not captured, and are streamed untouched once exceeded.
+	// Zero means no limit, and a negative value disables the body capture.
+	MaxBodySize int64
+
+	// Redactors are called with every entry before writing it, in order to remove sensitive data.
+	// The hash of the original request body is kept in the post data comment,
+	// so redacted requests can still be replayed.
+	Redactors []HARRedactor
+
+	// Filters restrict the captured requests.
+	Filters []Filter
+
+	// OnError is called with the errors produced writing the entries.
+	// If nil, errors are logged using the standard logger.
+	OnError func(error)
+}
+
+// NewHARCapture creates a new HAR capture interceptor writing the entries in the given sink.
+func NewHARCapture(sink HARSink) *HARCapture {
+	return &HARCapture{Sink: sink, Filters: []Filter{}}
+}
+
+// Filter captures an HTTP request if and only if the given filter returns true.
+func (c *HARCapture) Filter(f ...Filter) {
+	c.Filters = append(c.Filters, f...)
+}
+
+// Redact adds the given redactors to the capture.
+func (c *HARCapture) Redact(r ...HARRedactor) {
+	c.Redactors = append(c.Redactors, r...)
+}
+
+// HandleHTTP handles the middleware call chain, capturing the request and response data.
+// OPTIONS and HEAD requests are captured without their bodies.
+// This methods implements the middleware layer compatible interface.
+func (c *HARCapture) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	for _, filter := range c.Filters {
+		if !filter(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	headersOnly := r.Method == "OPTIONS" || r.Method == "HEAD"
+	if !headersOnly {
+		r = withBodyCache(r)
+	}
+	start := time.Now()
+	entry := &HAREntry{StartedDateTime: start.Format(time.RFC3339Nano), Request: c.captureRequest(r, headersOnly)}
+	sent := time.Now()
+
+	var waited time.Time
+	if headersOnly {
+		waited = c.serveHeaders(w, r, h, entry)
+	} else {
+		waited = c.serve(w, r, h, entry)
+	}
+	end := time.Now()
+
+	entry.Time = milliseconds(end.Sub(start))
+	entry.Timings = &HARTimings{
+		Blocked: -1,
+		DNS:     -1,
+		Connect: -1,
+		Send:    milliseconds(sent.Sub(start)),
+		Wait:    milliseconds(waited.Sub(sent)),
+		Receive: milliseconds(end.Sub(waited)),
+	}
+
+	for _, redact := range c.Redactors {
+		redact(entry)
+	}
+	if err := c.Sink.WriteEntry(entry); err != nil {
+		if c.OnError != nil {
+			c.OnError(err)
+		} else {
+			log.Printf("intercept: cannot write HAR entry: %s", err)
+		}
+	}
+}
+
+// serve calls the given handler, capturing the response and its body in the given entry,
+// and returns the time when the handler finished.
+func (c *HARCapture) serve(w http.ResponseWriter, r *http.Request, h http.Handler, entry *HAREntry) time.Time {
+	writer := NewWriterInterceptorE(w, r, func(res *ResponseModifier) error {
+		entry.Response = c.captureResponse(res.Response, res)
+		return nil
+	})
+	writer.Filter(func(res *http.Response) bool {
+		return c.MaxBodySize >= 0
+	})
+	writer.Limit(c.MaxBodySize, PassthroughOverflow)
+	defer writer.Close()
+
+	h.ServeHTTP(writer.ResponseWriter(), r)
+	waited := time.Now()
+	writer.Done()
+
+	if entry.Response == nil {
+		// The body has not been buffered
+		entry.Response = c.captureResponse(writer.response, nil)
+	}
+	return waited
+}
+
+// serveHeaders calls the given handler, capturing the response without its body in the given entry,
+// and returns the time when the handler finished.
+func (c *HARCapture) serveHeaders(w http.ResponseWriter, r *http.Request, h http.Handler, entry *HAREntry) time.Time {
+	writer := NewHeaderInterceptor(w, r, func(res *ResponseModifier) {
+		entry.Response = c.captureResponse(res.Response, nil)
+	})
+	h.ServeHTTP(writer.ResponseWriter(), r)
+	waited := time.Now()
+	writer.Done()
+	return waited
+}
+
+// captureRequest captures the given request, buffering its body if allowed.
+func (c *HARCapture) captureRequest(r *http.Request, headersOnly bool) *HARRequest {
+	req := &HARRequest{
+		Method:      r.Method,
+		URL:         requestURL(r),
+		HTTPVersion: r.Proto,
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(r.Header),
+		HeadersSize: -1,
+		BodySize:    r.ContentLength,
+	}
+	for _, cookie := range r.Cookies() {
+		req.Cookies = append(req.Cookies, HARCookie{Name: cookie.Name, Value: cookie.Value})
+	}
+	req.QueryString = harNameValues(r.URL.Query())
+
+	if r.Body == nil || r.Body == http.NoBody {
+		req.BodySize = 0
+		return req
+	}
+	if headersOnly || c.MaxBodySize < 0 || (c.MaxBodySize > 0 && r.ContentLength > c.MaxBodySize) {
+		req.Comment = harNotCaptured
+		return req
+	}
+
+	modifier := NewRequestModifier(r)
+	modifier.maxBodySize = c.MaxBodySize
+	body, err := modifier.ReadBytes()
+	if err != nil {
+		req.Comment = harNotCaptured + ": " + err.Error()
+		return req
+	}
+
+	req.PostData = &HARPostData{MimeType: r.Header.Get("Content-Type"), Comment: harBodyHash(body)}
+	req.PostData.Text, req.PostData.Encoding = harText(body)
+	return req
+}
+
+// captureResponse captures the given response, including its body if the modifier is defined.
+func (c *HARCapture) captureResponse(res *http.Response, modifier *ResponseModifier) *HARResponse {
+	response := &HARResponse{
+		Status:      res.StatusCode,
+		StatusText:  http.StatusText(res.StatusCode),
+		HTTPVersion: res.Proto,
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(res.Header),
+		Content:     HARContent{Size: -1, MimeType: res.Header.Get("Content-Type")},
+		RedirectURL: res.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    -1,
+	}
+	for _, cookie := range res.Cookies() {
+		response.Cookies = append(response.Cookies, HARCookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		})
+	}
+
+	if modifier == nil {
+		response.Content.Comment = harNotCaptured
+		return response
+	}
+
+	response.BodySize = res.ContentLength
+	body, err := modifier.ReadBytes()
+	if err != nil {
+		response.Content.Comment = harNotCaptured + ": " + err.Error()
+		return response
+	}
+
+	response.Content.Size = int64(len(body))
+	response.Content.Text, response.Content.Encoding = harText(body)
+	return response
+}
+
+// harText returns the given body as text, base64 encoded if it is not valid UTF-8,
+// and the encoding used.
+func harText(body []byte) (string, string) {
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), "base64"
+	}
+	return string(body), ""
+}
+
+// harBodyHash returns the comment storing the hash of the given request body.
+func harBodyHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return harBodyHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// requestURL returns the absolute URL of the given request.
+func requestURL(r *http.Request) string {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	return u.String()
+}
+
+func harHeaders(header http.Header) []HARNameValue {
+	return harNameValues(header)
+}
+
+// harNameValues returns the given values sorted by name.
+func harNameValues(values map[string][]string) []HARNameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []HARNameValue{}
+	for _, name := range names {
+		for _, value := range values[name] {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,206 @@
+package intercept
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeHAR(t *testing.T, data []byte) *HAR {
+	har := &HAR{}
+	st.Assert(t, json.Unmarshal(data, har), nil)
+	return har
+}
+
+func TestHARCapture(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewHARWriter(buf)
+	capture := NewHARCapture(writer)
+	capture.Redact(RedactHeaders("Authorization", "Set-Cookie"), RedactJSON("/password"))
+
+	req, _ := http.NewRequest("POST", "http://example.com/login?next=%2Fhome", strings.NewReader(`{"user":"rick","password":"secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer token")
+	w := serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), `{"user":"rick","password":"secret"}`)
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "1234", HttpOnly: true})
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(201)
+		w.Write([]byte("Hello"))
+	})
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Body.String(), "Hello")
+	st.Expect(t, w.Header().Get("Set-Cookie"), "session=1234; HttpOnly")
+	st.Assert(t, writer.Close(), nil)
+
+	har := decodeHAR(t, buf.Bytes())
+	st.Expect(t, har.Log.Version, "1.2")
+	st.Assert(t, len(har.Log.Entries), 1)
+
+	entry := har.Log.Entries[0]
+	st.Expect(t, entry.Request.Method, "POST")
+	st.Expect(t, entry.Request.URL, "http://example.com/login?next=%2Fhome")
+	st.Expect(t, entry.Request.QueryString, []HARNameValue{{Name: "next", Value: "/home"}})
+	st.Expect(t, entry.Request.Headers[0], HARNameValue{Name: "Authorization", Value: HARRedacted})
+	st.Expect(t, entry.Request.PostData.Text, `{"user":"rick","password":"REDACTED"}`)
+	st.Expect(t, entry.Request.BodySize, int64(35))
+
+	st.Expect(t, entry.Response.Status, 201)
+	st.Expect(t, entry.Response.StatusText, "Created")
+	st.Expect(t, entry.Response.Content, HARContent{Size: 5, MimeType: "text/plain", Text: "Hello"})
+	st.Expect(t, entry.Response.Cookies, []HARCookie{{Name: "session", Value: HARRedacted, HTTPOnly: true}})
+	st.Expect(t, entry.Timings.Send >= 0 && entry.Timings.Wait >= 0 && entry.Timings.Receive >= 0, true)
+	st.Expect(t, entry.Time >= entry.Timings.Wait, true)
+}
+
+func TestHARCaptureBodyLimits(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewHARWriter(buf)
+	capture := NewHARCapture(writer)
+	capture.MaxBodySize = 4
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("request body"))
+	w := serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("response body"))
+	})
+	st.Expect(t, w.Body.String(), "response body")
+
+	req, _ = http.NewRequest("POST", "http://example.com/", ioutil.NopCloser(strings.NewReader("chunked body")))
+	w = serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), "chunked body")
+		w.Header().Set("Content-Length", "13")
+		w.Write([]byte("response body"))
+	})
+	st.Expect(t, w.Body.String(), "response body")
+
+	req, _ = http.NewRequest("GET", "http://example.com/", nil)
+	w = serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("body"))
+	})
+	st.Expect(t, w.Body.String(), "body")
+	writer.Close()
+
+	har := decodeHAR(t, buf.Bytes())
+	st.Assert(t, len(har.Log.Entries), 3)
+
+	// Request announced larger than the limit, response exceeding the limit
+	entry := har.Log.Entries[0]
+	st.Expect(t, entry.Request.PostData, (*HARPostData)(nil))
+	st.Expect(t, entry.Request.Comment, "body not captured")
+	st.Expect(t, entry.Response.Content, HARContent{Size: -1, Comment: "body not captured"})
+
+	// Request exceeding the limit, response announced larger than the limit
+	entry = har.Log.Entries[1]
+	st.Expect(t, entry.Request.PostData, (*HARPostData)(nil))
+	st.Expect(t, entry.Request.Comment, "body not captured: intercept: body exceeds the maximum size of 4 bytes")
+	st.Expect(t, entry.Response.Status, 200)
+	st.Expect(t, entry.Response.Content, HARContent{Size: -1, Comment: "body not captured"})
+
+	// Bodies within the limit
+	entry = har.Log.Entries[2]
+	st.Expect(t, entry.Request.BodySize, int64(0))
+	st.Expect(t, entry.Response.Content, HARContent{Size: 4, Text: "body"})
+}
+
+func TestHARCaptureHeadersOnly(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewHARWriter(buf)
+	capture := NewHARCapture(writer)
+
+	req, _ := http.NewRequest("HEAD", "http://example.com/", nil)
+	w := serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "1234")
+	})
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("Content-Length"), "1234")
+
+	req, _ = http.NewRequest("OPTIONS", "http://example.com/", strings.NewReader("preflight"))
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	w = serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Methods", "GET, PUT")
+		w.WriteHeader(204)
+	})
+	st.Expect(t, w.Code, 204)
+	writer.Close()
+
+	// Bodies are not captured
+	entries := decodeHAR(t, buf.Bytes()).Log.Entries
+	st.Assert(t, len(entries), 2)
+	st.Expect(t, entries[0].Request.Method, "HEAD")
+	st.Expect(t, entries[0].Response.Headers, []HARNameValue{{Name: "Content-Length", Value: "1234"}})
+	st.Expect(t, entries[0].Response.Content, HARContent{Size: -1, Comment: "body not captured"})
+	st.Expect(t, entries[1].Request.Method, "OPTIONS")
+	st.Expect(t, entries[1].Request.Comment, "body not captured")
+	st.Expect(t, entries[1].Request.PostData, (*HARPostData)(nil))
+	st.Expect(t, entries[1].Response.Status, 204)
+	st.Expect(t, entries[1].Response.Headers, []HARNameValue{{Name: "Access-Control-Allow-Methods", Value: "GET, PUT"}})
+}
+
+func TestHARCaptureBinaryBody(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewHARWriter(buf)
+	capture := NewHARCapture(writer)
+
+	req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader([]byte{0x89, 0x50, 0x4e, 0x47}))
+	req.Header.Set("Content-Type", "image/png")
+	serve(capture, req, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, body, []byte{0x89, 0x50, 0x4e, 0x47})
+		w.Write([]byte{0xff, 0xfe, 0x00})
+	})
+	writer.Close()
+
+	entry := decodeHAR(t, buf.Bytes()).Log.Entries[0]
+	st.Expect(t, *entry.Request.PostData, HARPostData{
+		MimeType: "image/png",
+		Text:     "iVBORw==",
+		Encoding: "base64",
+		Comment:  "sha256:0f4636c78f65d3639ece5a064b5ae753e3408614a14fb18ab4d7540d2c248543",
+	})
+	st.Expect(t, entry.Response.Content.Encoding, "base64")
+	st.Expect(t, entry.Response.Content.Text, "//4A")
+}
+
+func TestHARWriterEmpty(t *testing.T) {
+	buf := &bytes.Buffer{}
+	st.Expect(t, NewHARWriter(buf).Close(), nil)
+	st.Expect(t, len(decodeHAR(t, buf.Bytes()).Log.Entries), 0)
+}
+
+func TestHARFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	file, err := NewHARFile(filepath.Join(dir, "capture.har"), 0, 2)
+	st.Assert(t, err, nil)
+
+	capture := NewHARCapture(file)
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		serve(capture, req, func(w http.ResponseWriter, r *http.Request) {})
+	}
+	st.Assert(t, file.Close(), nil)
+
+	rotated, _ := filepath.Glob(filepath.Join(dir, "capture-*.har"))
+	st.Expect(t, len(rotated), 2)
+	for _, path := range rotated {
+		name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "capture-"), ".har")
+		_, err := time.Parse(harRotationFormat, name)
+		st.Expect(t, err, nil)
+		st.Expect(t, len(name), len("20160102T150405.000000000"))
+	}
+
+	entries := 0
+	for _, path := range append(rotated, filepath.Join(dir, "capture.har")) {
+		data, err := ioutil.ReadFile(path)
+		st.Assert(t, err, nil)
+		entries += len(decodeHAR(t, data).Log.Entries)
+	}
+	st.Expect(t, entries, 5)
+}
@@ -0,0 +1,167 @@
+package intercept
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// HeaderInterceptor implements an http.ResponseWriter compatible interface that calls
+// a response modifier function once the response status and headers are known,
+// streaming the body straight through to the client without buffering it.
+type HeaderInterceptor struct {
+	wroteHeader bool
+	response    *http.Response
+	modifier    ResModifierFunc
+	writer      http.ResponseWriter
+}
+
+// NewHeaderInterceptor creates a new http.ResponseWriter capable interface
+// that will intercept the status and headers of the current response.
+// The response body is not available to the modifier: reading it returns no data,
+// and bodies set by the modifier are ignored.
+func NewHeaderInterceptor(w http.ResponseWriter, req *http.Request, fn ResModifierFunc) *HeaderInterceptor {
+	res := &http.Response{
+		Request:    req,
+		StatusCode: 200,
+		Status:     "200 OK",
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+	}
+	return &HeaderInterceptor{writer: w, modifier: fn, response: res}
+}
+
+// Header returns the current response http.Header.
+func (w *HeaderInterceptor) Header() http.Header {
+	return w.response.Header
+}
+
+// WriteHeader calls the modifier function with the intercepted status code and headers,
+// and writes the resulting ones in the real http.ResponseWriter.
+// Informational status codes are written untouched.
+func (w *HeaderInterceptor) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.writeHeader(status)
+		return
+	}
+
+	w.wroteHeader = true
+	w.response.StatusCode = status
+	w.response.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	w.response.ContentLength = -1
+	if length, err := strconv.ParseInt(w.response.Header.Get("Content-Length"), 10, 64); err == nil {
+		w.response.ContentLength = length
+	}
+
+	length := w.response.Header["Content-Length"]
+	w.modifier(NewResponseModifier(w.response.Request, w.response))
+	if w.response.Body != http.NoBody {
+		// Bodies set by the modifier are ignored
+		w.response.Body = http.NoBody
+		w.response.Header.Del("Content-Length")
+		if length != nil {
+			w.response.Header["Content-Length"] = length
+		}
+	}
+	w.writeHeader(w.response.StatusCode)
+}
+
+// writeHeader writes the current response header fields and the given status code.
+func (w *HeaderInterceptor) writeHeader(status int) {
+	target := w.writer.Header()
+	for k, v := range w.response.Header {
+		target[k] = v
+	}
+	w.writer.WriteHeader(status)
+}
+
+// Write writes the given chunk of bytes in the real http.ResponseWriter.
+func (w *HeaderInterceptor) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.writer.Write(b)
+}
+
+// Done notifies the interceptor that the intercepted handler finished writing the response,
+// calling the modifier function if the handler wrote no header nor body.
+func (w *HeaderInterceptor) Done() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// Flush flushes the response to the client.
+func (w *HeaderInterceptor) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the underlying connection.
+func (w *HeaderInterceptor) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	w.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+// Push initiates an HTTP/2 server push using the underlying http.ResponseWriter.
+func (w *HeaderInterceptor) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := w.writer.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// ReadFrom reads data from the given reader as part of the response body,
+// using the underlying io.ReaderFrom if available to avoid copies.
+func (w *HeaderInterceptor) ReadFrom(r io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if readerFrom, ok := w.writer.(io.ReaderFrom); ok {
+		return readerFrom.ReadFrom(r)
+	}
+	return io.Copy(w.writer, r)
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+// This method is used by http.ResponseController.
+func (w *HeaderInterceptor) Unwrap() http.ResponseWriter {
+	return w.writer
+}
+
+// ResponseWriter returns an http.ResponseWriter that intercepts the current response,
+// implementing exactly the optional interfaces supported by the underlying http.ResponseWriter
+// among http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom.
+func (w *HeaderInterceptor) ResponseWriter() http.ResponseWriter {
+	return exposeFeatures(w)
+}
+
+// ResponseHeaders intercepts the status and headers of an HTTP response and passes them
+// to the given response modifier function, before the response body is written.
+// The body is streamed straight through to the client without being buffered.
+func ResponseHeaders(fn ResModifierFunc) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writer := NewHeaderInterceptor(w, r, fn)
+			h.ServeHTTP(writer.ResponseWriter(), r)
+			writer.Done()
+		})
+	}
+}
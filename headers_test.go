@@ -0,0 +1,86 @@
+package intercept
+
+import (
+	"github.com/nbio/st"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	calls := 0
+	handler := ResponseHeaders(func(m *ResponseModifier) {
+		calls++
+		st.Expect(t, m.Response.StatusCode, 201)
+		st.Expect(t, m.Response.ContentLength, int64(5))
+		m.Header.Set("X-Modified", "true")
+		m.Header.Del("Server")
+		m.Status(202)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "upstream")
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(201)
+		w.Write([]byte("He"))
+		w.Write([]byte("llo"))
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	handler.ServeHTTP(w, req)
+	st.Expect(t, calls, 1)
+	st.Expect(t, w.Code, 202)
+	st.Expect(t, w.Header().Get("X-Modified"), "true")
+	st.Expect(t, w.Header().Get("Server"), "")
+	st.Expect(t, w.Body.String(), "Hello")
+}
+
+func TestResponseHeadersNoBody(t *testing.T) {
+	handler := ResponseHeaders(func(m *ResponseModifier) {
+		st.Expect(t, m.Response.StatusCode, 200)
+		m.Header.Set("X-Modified", "true")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("HEAD", "http://example.com/", nil)
+	handler.ServeHTTP(w, req)
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("X-Modified"), "true")
+}
+
+func TestResponseHeadersIgnoresBody(t *testing.T) {
+	handler := ResponseHeaders(func(m *ResponseModifier) {
+		body, err := m.ReadString()
+		st.Expect(t, err, nil)
+		st.Expect(t, body, "")
+		m.String("modified")
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		w.Write([]byte("Hello"))
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	handler.ServeHTTP(w, req)
+	st.Expect(t, w.Header().Get("Content-Length"), "5")
+	st.Expect(t, w.Body.String(), "Hello")
+}
+
+func TestHeaderInterceptorReadFrom(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewHeaderInterceptor(&readerFromWriter{recorder}, &http.Request{}, func(m *ResponseModifier) {
+		m.Header.Set("X-Modified", "true")
+	}).ResponseWriter()
+
+	readerFrom, ok := writer.(io.ReaderFrom)
+	st.Expect(t, ok, true)
+	_, isHijacker := writer.(http.Hijacker)
+	st.Expect(t, isHijacker, false)
+
+	n, err := readerFrom.ReadFrom(strings.NewReader("Hello"))
+	st.Expect(t, err, nil)
+	st.Expect(t, n, int64(5))
+	st.Expect(t, recorder.Header().Get("X-Modified"), "true")
+	st.Expect(t, recorder.Body.String(), "Hello")
+}
@@ -0,0 +1,509 @@
+package intercept
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	htmlcharset "golang.org/x/net/html/charset"
+)
+
+// EditHTML parses the current http.Response HTML body and applies the changes of the given editor,
+// encoding the result based on the Content-Type charset, or the charset declared by the document
+// if not defined. Non-HTML bodies are left untouched.
+func (s *ResponseModifier) EditHTML(editor *HTMLEditor) error {
+	if !isHTML(s.Header) {
+		return nil
+	}
+
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return err
+	}
+	if charset := htmlCharset(s.Header, buf); charset != nil {
+		if buf, err = ioutil.ReadAll(charset.NewDecoder(bytes.NewReader(buf))); err != nil {
+			return err
+		}
+	}
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	if err := editor.apply(doc); err != nil {
+		return err
+	}
+
+	out := &bytes.Buffer{}
+	if err := html.Render(out, doc); err != nil {
+		return err
+	}
+	s.setText(out.Bytes())
+	return nil
+}
+
+// htmlOperation represents an operation applied to the elements matching a CSS selector.
+type htmlOperation struct {
+	selector cascadia.Selector
+	attrs    func([]html.Attribute) []html.Attribute
+	content  *string
+}
+
+// HTMLEditor implements an editor of HTML documents based on CSS selectors.
+// Changes are recorded and applied in order, either parsing the whole document
+// with ResponseModifier.EditHTML, or tokenizing it on the fly with Stream.
+type HTMLEditor struct {
+	head       []string
+	body       []string
+	operations []htmlOperation
+}
+
+// NewHTMLEditor creates a new HTMLEditor with no changes.
+func NewHTMLEditor() *HTMLEditor {
+	return &HTMLEditor{}
+}
+
+// InjectHead appends the given HTML markup, such as a script or style element,
+// at the end of the document head.
+func (e *HTMLEditor) InjectHead(markup string) {
+	e.head = append(e.head, markup)
+}
+
+// InjectBody appends the given HTML markup, such as a script element,
+// at the end of the document body.
+func (e *HTMLEditor) InjectBody(markup string) {
+	e.body = append(e.body, markup)
+}
+
+// SetAttr sets the given attribute value in the elements matching the given CSS selector.
+func (e *HTMLEditor) SetAttr(selector, name, value string) error {
+	name = strings.ToLower(name)
+	return e.add(selector, htmlOperation{attrs: func(attrs []html.Attribute) []html.Attribute {
+		for i, attr := range attrs {
+			if attr.Namespace == "" && attr.Key == name {
+				attrs[i].Val = value
+				return attrs
+			}
+		}
+		return append(attrs, html.Attribute{Key: name, Val: value})
+	}})
+}
+
+// RemoveAttr removes the given attribute from the elements matching the given CSS selector.
+func (e *HTMLEditor) RemoveAttr(selector, name string) error {
+	name = strings.ToLower(name)
+	return e.add(selector, htmlOperation{attrs: func(attrs []html.Attribute) []html.Attribute {
+		result := attrs[:0]
+		for _, attr := range attrs {
+			if attr.Namespace != "" || attr.Key != name {
+				result = append(result, attr)
+			}
+		}
+		return result
+	}})
+}
+
+// SetContent replaces the contents of the elements matching the given CSS selector
+// with the given HTML markup.
+func (e *HTMLEditor) SetContent(selector, markup string) error {
+	return e.add(selector, htmlOperation{content: &markup})
+}
+
+// RewriteURLs replaces the href and src attribute values of every element
+// with the result of the given function.
+func (e *HTMLEditor) RewriteURLs(fn func(string) string) {
+	e.operations = append(e.operations, htmlOperation{
+		selector: func(n *html.Node) bool { return n.Type == html.ElementNode },
+		attrs: func(attrs []html.Attribute) []html.Attribute {
+			for i, attr := range attrs {
+				if attr.Namespace == "" && (attr.Key == "href" || attr.Key == "src") {
+					attrs[i].Val = fn(attr.Val)
+				}
+			}
+			return attrs
+		},
+	})
+}
+
+// add compiles the given CSS selector and records the given operation.
+func (e *HTMLEditor) add(selector string, operation htmlOperation) error {
+	compiled, err := cascadia.Compile(selector)
+	if err != nil {
+		return err
+	}
+	operation.selector = compiled
+	e.operations = append(e.operations, operation)
+	return nil
+}
+
+// apply applies the recorded changes to the given parsed document.
+func (e *HTMLEditor) apply(doc *html.Node) error {
+	for _, operation := range e.operations {
+		for _, node := range cascadia.QueryAll(doc, operation.selector) {
+			if operation.attrs != nil {
+				node.Attr = operation.attrs(node.Attr)
+			}
+			if operation.content != nil {
+				if err := setHTMLContent(node, *operation.content); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, inject := range []struct {
+		element atom.Atom
+		markup  []string
+	}{{atom.Head, e.head}, {atom.Body, e.body}} {
+		if len(inject.markup) == 0 {
+			continue
+		}
+		node := cascadia.Query(doc, cascadia.Selector(func(n *html.Node) bool {
+			return n.Type == html.ElementNode && n.DataAtom == inject.element
+		}))
+		if node == nil {
+			continue
+		}
+		for _, markup := range inject.markup {
+			if err := appendHTML(node, markup); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// setHTMLContent replaces the children of the given node with the given HTML markup.
+func setHTMLContent(node *html.Node, markup string) error {
+	for child := node.FirstChild; child != nil; child = node.FirstChild {
+		node.RemoveChild(child)
+	}
+	return appendHTML(node, markup)
+}
+
+// appendHTML parses the given HTML markup in the context of the given node,
+// appending the resulting nodes as its children.
+func appendHTML(node *html.Node, markup string) error {
+	nodes, err := html.ParseFragment(strings.NewReader(markup), node)
+	if err != nil {
+		return err
+	}
+	for _, child := range nodes {
+		node.AppendChild(child)
+	}
+	return nil
+}
+
+// Stream returns a reader of the given HTML response body with the changes applied,
+// tokenizing the document as it is read instead of parsing it as a whole,
+// so it can be used as StreamModifierFunc to edit large pages with bounded memory.
+// CSS selectors are matched against the element and its open ancestors,
+// so selectors depending on sibling elements are not supported.
+// The body is decoded based on the Content-Encoding header and the Content-Type charset,
+// or the charset declared in the first 1024 bytes of the document if not defined,
+// and streamed as UTF-8 text. Non-HTML bodies are streamed untouched.
+func (e *HTMLEditor) Stream(res *http.Response, body io.Reader) io.Reader {
+	codecs, ok := contentCodecs(res.Header)
+	if !ok || !isHTML(res.Header) {
+		return nil
+	}
+
+	// Documents are streamed as UTF-8, so the header is ready before the charset prescan
+	var charset Charset
+	prescan := !hasCharset(res.Header)
+	if !prescan {
+		charset, _ = contentCharset(res.Header)
+	}
+	if prescan || charset != nil {
+		setCharset(res.Header, "utf-8")
+	}
+
+	reader, pipe := io.Pipe()
+	go func() {
+		var err error
+		for i := len(codecs) - 1; i >= 0 && err == nil; i-- {
+			var rc io.ReadCloser
+			if rc, err = codecs[i].NewReader(body); err == nil {
+				defer rc.Close()
+				body = rc
+			}
+		}
+		if err != nil {
+			pipe.CloseWithError(err)
+			return
+		}
+
+		if prescan {
+			buffered := bufio.NewReaderSize(body, htmlPrescanSize)
+			prefix, _ := buffered.Peek(htmlPrescanSize)
+			body = buffered
+			charset, _ = sniffHTMLCharset(prefix)
+		}
+		if charset != nil {
+			body = charset.NewDecoder(body)
+		}
+		pipe.CloseWithError(e.stream(body, pipe))
+	}()
+
+	if encoded, ok := encodeReader(res.Header, reader); ok {
+		return encoded
+	}
+	return reader
+}
+
+// stream tokenizes the given HTML document, writing it with the changes applied.
+func (e *HTMLEditor) stream(r io.Reader, w io.Writer) error {
+	out := bufio.NewWriterSize(w, streamChunkSize)
+	tokenizer := html.NewTokenizer(r)
+	injectedHead, injectedBody := len(e.head) == 0, len(e.body) == 0
+
+	// Open elements, linked to their parents so selectors can match ancestors
+	var open []*html.Node
+	// Depth of the element which content is being replaced, or zero
+	skip := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			if err := tokenizer.Err(); err != io.EOF {
+				return err
+			}
+			if !injectedHead {
+				writeMarkup(out, e.head)
+			}
+			if !injectedBody {
+				writeMarkup(out, e.body)
+			}
+			return out.Flush()
+		}
+
+		raw := append([]byte(nil), tokenizer.Raw()...)
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			open = closeImplied(open, token.DataAtom)
+			if skip > len(open) {
+				// The replaced element has been implicitly closed
+				skip = 0
+			}
+			if skip > 0 {
+				if tokenType == html.StartTagToken && !isVoidElement(token.DataAtom) {
+					open = append(open, &html.Node{Type: html.ElementNode, Data: token.Data, DataAtom: token.DataAtom})
+				}
+				continue
+			}
+			if token.DataAtom == atom.Body && !injectedHead {
+				writeMarkup(out, e.head)
+				injectedHead = true
+			}
+
+			node := &html.Node{Type: html.ElementNode, Data: token.Data, DataAtom: token.DataAtom, Attr: token.Attr}
+			if len(open) > 0 {
+				node.Parent = open[len(open)-1]
+			}
+			modified, content := e.match(node)
+			if modified {
+				token.Attr = node.Attr
+				raw = []byte(token.String())
+			}
+			out.Write(raw)
+
+			if tokenType == html.StartTagToken && !isVoidElement(token.DataAtom) {
+				open = append(open, node)
+				if content != nil {
+					out.WriteString(*content)
+					skip = len(open)
+				}
+			}
+			continue
+
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			element := atom.Lookup(name)
+			for i := len(open) - 1; i >= 0; i-- {
+				if open[i].Data == string(name) {
+					open = open[:i]
+					break
+				}
+			}
+			if skip > 0 {
+				if len(open) >= skip {
+					continue
+				}
+				skip = 0
+			}
+			if element == atom.Head && !injectedHead {
+				writeMarkup(out, e.head)
+				injectedHead = true
+			}
+			if (element == atom.Body || element == atom.Html) && !injectedBody {
+				writeMarkup(out, e.body)
+				injectedBody = true
+			}
+		}
+
+		if skip == 0 {
+			out.Write(raw)
+		}
+	}
+}
+
+// match applies the attribute changes of the operations matching the given element.
+// It returns true if any attribute was changed, and the last matching replacement content.
+func (e *HTMLEditor) match(node *html.Node) (modified bool, content *string) {
+	for _, operation := range e.operations {
+		if !operation.selector.Match(node) {
+			continue
+		}
+		if operation.attrs != nil {
+			node.Attr = operation.attrs(node.Attr)
+			modified = true
+		}
+		if operation.content != nil {
+			content = operation.content
+		}
+	}
+	return modified, content
+}
+
+// closeImplied removes the open elements implicitly closed by the given start tag,
+// such as a p element followed by a div, or a li element followed by another li,
+// as the HTML parser does.
+func closeImplied(open []*html.Node, start atom.Atom) []*html.Node {
+	for i := len(open) - 1; i >= 0; i-- {
+		element := open[i].DataAtom
+		if closesElement(start, element) {
+			open = open[:i]
+		} else if !impliedScope(start, element) {
+			break
+		}
+	}
+	return open
+}
+
+// impliedScope returns true if the elements implicitly closed by the given start tag
+// are looked up through the given open element.
+func impliedScope(start, element atom.Atom) bool {
+	switch start {
+	case atom.Td, atom.Th, atom.Tr, atom.Tbody, atom.Thead, atom.Tfoot:
+		return element != atom.Table
+	case atom.Li, atom.Dt, atom.Dd:
+		if element == atom.Address || element == atom.Div || element == atom.P {
+			return true
+		}
+	}
+	return isInlineElement(element)
+}
+
+// closesElement returns true if the given start tag implies the end tag of the given open element.
+func closesElement(start, element atom.Atom) bool {
+	switch element {
+	case atom.P:
+		return closesParagraph(start)
+	case atom.Li:
+		return start == atom.Li
+	case atom.Dt, atom.Dd:
+		return start == atom.Dt || start == atom.Dd
+	case atom.Tr:
+		return start == atom.Tr || start == atom.Tbody || start == atom.Thead || start == atom.Tfoot
+	case atom.Td, atom.Th:
+		return start == atom.Td || start == atom.Th || start == atom.Tr ||
+			start == atom.Tbody || start == atom.Thead || start == atom.Tfoot
+	case atom.Tbody, atom.Thead, atom.Tfoot:
+		return start == atom.Tbody || start == atom.Thead || start == atom.Tfoot
+	case atom.Option:
+		return start == atom.Option || start == atom.Optgroup
+	}
+	return false
+}
+
+// closesParagraph returns true if the given start tag implies the end tag of an open p element.
+func closesParagraph(start atom.Atom) bool {
+	switch start {
+	case atom.Address, atom.Article, atom.Aside, atom.Blockquote, atom.Dd, atom.Details, atom.Dialog,
+		atom.Div, atom.Dl, atom.Dt, atom.Fieldset, atom.Figcaption, atom.Figure, atom.Footer, atom.Form,
+		atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Header, atom.Hgroup, atom.Hr, atom.Li,
+		atom.Main, atom.Menu, atom.Nav, atom.Ol, atom.P, atom.Pre, atom.Section, atom.Summary, atom.Table, atom.Ul:
+		return true
+	}
+	return false
+}
+
+// isInlineElement returns true if the given element is looked through to find the elements
+// implicitly closed by a start tag.
+func isInlineElement(element atom.Atom) bool {
+	switch element {
+	case atom.A, atom.Abbr, atom.B, atom.Big, atom.Cite, atom.Code, atom.Em, atom.Font, atom.I, atom.Kbd,
+		atom.Label, atom.Mark, atom.Nobr, atom.Q, atom.S, atom.Samp, atom.Small, atom.Span, atom.Strike,
+		atom.Strong, atom.Sub, atom.Sup, atom.Time, atom.Tt, atom.U, atom.Var:
+		return true
+	}
+	return false
+}
+
+// writeMarkup writes the given HTML markup fragments.
+func writeMarkup(w *bufio.Writer, markup []string) {
+	for _, m := range markup {
+		w.WriteString(m)
+	}
+}
+
+// isVoidElement returns true if the given element has no content nor end tag.
+func isVoidElement(element atom.Atom) bool {
+	switch element {
+	case atom.Area, atom.Base, atom.Br, atom.Col, atom.Embed, atom.Hr, atom.Img, atom.Input,
+		atom.Link, atom.Meta, atom.Param, atom.Source, atom.Track, atom.Wbr:
+		return true
+	}
+	return false
+}
+
+// htmlPrescanSize defines the number of bytes of an HTML document looked up for a charset declaration.
+const htmlPrescanSize = 1024
+
+// htmlCharset returns the Charset of the given HTML document based on the Content-Type charset.
+// If not defined, the byte order mark or <meta> charset declaration of the document are used,
+// and the detected charset is set in the Content-Type header.
+// It returns nil for UTF-8 documents and unsupported charsets.
+func htmlCharset(header http.Header, doc []byte) Charset {
+	if hasCharset(header) {
+		charset, _ := contentCharset(header)
+		return charset
+	}
+
+	charset, name := sniffHTMLCharset(doc)
+	if charset != nil {
+		setCharset(header, name)
+	}
+	return charset
+}
+
+// sniffHTMLCharset returns the Charset and name declared by the given prefix of an HTML document.
+// It returns nil for UTF-8 documents.
+func sniffHTMLCharset(doc []byte) (Charset, string) {
+	encoding, name, certain := htmlcharset.DetermineEncoding(doc, "")
+	// Documents without declaration fall back to windows-1252, unless they are valid UTF-8
+	if isUTF8(name) || (!certain && name == "windows-1252" && utf8.Valid(doc)) {
+		return nil, name
+	}
+	return TextCharset(encoding), name
+}
+
+// hasCharset returns true if the Content-Type header defines a charset parameter.
+func hasCharset(header http.Header) bool {
+	_, params, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return params["charset"] != ""
+}
+
+// isHTML returns true if the Content-Type header defines an HTML document.
+func isHTML(header http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
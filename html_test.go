@@ -0,0 +1,165 @@
+package intercept
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const htmlDocument = `<!DOCTYPE html><html><head><title>Moby-Dick</title></head>` +
+	`<body><div id="main"><a href="/app/chapter/1" class="link">Loomings</a><img src="/app/whale.png"></div>` +
+	`<p class="ad">Buy <b>now</b></p><script>var a = "</div>";</script></body></html>`
+
+func newHTMLEditor(t *testing.T) *HTMLEditor {
+	editor := NewHTMLEditor()
+	editor.InjectHead(`<link rel="stylesheet" href="/style.css">`)
+	editor.InjectBody(`<script src="/analytics.js"></script>`)
+	st.Expect(t, editor.SetAttr("#main a.link", "target", "_blank"), nil)
+	st.Expect(t, editor.RemoveAttr("a", "CLASS"), nil)
+	st.Expect(t, editor.SetContent("p.ad", "<i>removed</i>"), nil)
+	editor.RewriteURLs(func(u string) string {
+		return strings.Replace(u, "/app/", "/public/", 1)
+	})
+	return editor
+}
+
+func TestHTMLEditor(t *testing.T) {
+	res := &http.Response{
+		Header: http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:   ioutil.NopCloser(strings.NewReader(htmlDocument)),
+	}
+	modifier := NewResponseModifier(nil, res)
+	st.Expect(t, modifier.EditHTML(newHTMLEditor(t)), nil)
+
+	body, _ := modifier.ReadString()
+	st.Expect(t, body, `<!DOCTYPE html><html><head><title>Moby-Dick</title><link rel="stylesheet" href="/style.css"/></head>`+
+		`<body><div id="main"><a href="/public/chapter/1" target="_blank">Loomings</a><img src="/public/whale.png"/></div>`+
+		`<p class="ad"><i>removed</i></p><script>var a = "</div>";</script><script src="/analytics.js"></script></body></html>`)
+}
+
+func TestHTMLEditorNotHTML(t *testing.T) {
+	res := &http.Response{
+		Header: http.Header{"Content-Type": {"application/json"}},
+		Body:   ioutil.NopCloser(strings.NewReader(`{"html":"<p></p>"}`)),
+	}
+	modifier := NewResponseModifier(nil, res)
+	st.Expect(t, modifier.EditHTML(newHTMLEditor(t)), nil)
+	body, _ := modifier.ReadString()
+	st.Expect(t, body, `{"html":"<p></p>"}`)
+	st.Expect(t, newHTMLEditor(t).Stream(res, res.Body), nil)
+}
+
+func TestHTMLEditorInvalidSelector(t *testing.T) {
+	editor := NewHTMLEditor()
+	st.Reject(t, editor.SetAttr("a[", "href", "/"), nil)
+	st.Expect(t, len(editor.operations), 0)
+}
+
+func TestHTMLEditorStream(t *testing.T) {
+	res := &http.Response{Header: http.Header{"Content-Type": {"text/html"}}}
+	body, err := ioutil.ReadAll(newHTMLEditor(t).Stream(res, strings.NewReader(htmlDocument)))
+	st.Expect(t, err, nil)
+
+	// Unmodified markup is kept as sent
+	st.Expect(t, string(body), `<!DOCTYPE html><html><head><title>Moby-Dick</title><link rel="stylesheet" href="/style.css"></head>`+
+		`<body><div id="main"><a href="/public/chapter/1" target="_blank">Loomings</a><img src="/public/whale.png"></div>`+
+		`<p class="ad"><i>removed</i></p><script>var a = "</div>";</script><script src="/analytics.js"></script></body></html>`)
+
+	// Missing head and body elements
+	body, err = ioutil.ReadAll(newHTMLEditor(t).Stream(res, strings.NewReader(`<p class="ad">Hello</p>`)))
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), `<p class="ad"><i>removed</i></p><link rel="stylesheet" href="/style.css"><script src="/analytics.js"></script>`)
+}
+
+func TestHTMLEditorStreamEncoded(t *testing.T) {
+	handler := ResponseStream(newHTMLEditor(t).Stream)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=iso-8859-1")
+		w.Header().Set("Content-Encoding", "gzip")
+		writer := gzip.NewWriter(w)
+		writer.Write([]byte("<html><body><p class=\"ad\">Caf\xe9</p><p>Caf\xe9</p></body></html>"))
+		writer.Close()
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	handler.ServeHTTP(w, req)
+	st.Expect(t, w.Header().Get("Content-Type"), "text/html; charset=utf-8")
+
+	reader, err := gzip.NewReader(bytes.NewReader(w.Body.Bytes()))
+	st.Expect(t, err, nil)
+	body, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(body), `<html><link rel="stylesheet" href="/style.css"><body><p class="ad"><i>removed</i></p><p>Café</p><script src="/analytics.js"></script></body></html>`)
+}
+
+func TestHTMLEditorMetaCharset(t *testing.T) {
+	document := "<html><head><meta charset=\"iso-8859-1\"><title>Caf\xe9</title></head>" +
+		"<body><p class=\"ad\">Buy</p></body></html>"
+	editor := NewHTMLEditor()
+	st.Expect(t, editor.SetContent("p.ad", "Crème"), nil)
+
+	res := &http.Response{
+		Header: http.Header{"Content-Type": {"text/html"}},
+		Body:   ioutil.NopCloser(strings.NewReader(document)),
+	}
+	modifier := NewResponseModifier(nil, res)
+	st.Expect(t, modifier.EditHTML(editor), nil)
+	body, _ := modifier.ReadBytes()
+	st.Expect(t, res.Header.Get("Content-Type"), "text/html; charset=windows-1252")
+	st.Expect(t, string(body), "<html><head><meta charset=\"iso-8859-1\"/><title>Caf\xe9</title></head>"+
+		"<body><p class=\"ad\">Cr\xe8me</p></body></html>")
+
+	res = &http.Response{Header: http.Header{"Content-Type": {"text/html"}}}
+	stream, err := ioutil.ReadAll(editor.Stream(res, strings.NewReader(document)))
+	st.Expect(t, err, nil)
+	st.Expect(t, res.Header.Get("Content-Type"), "text/html; charset=utf-8")
+	st.Expect(t, string(stream), `<html><head><meta charset="iso-8859-1"><title>Café</title></head>`+
+		`<body><p class="ad">Crème</p></body></html>`)
+}
+
+func TestHTMLEditorStreamImpliedEndTags(t *testing.T) {
+	editor := NewHTMLEditor()
+	st.Expect(t, editor.SetAttr("ul > li, dl > dd, tr > td, select > option", "class", "child"), nil)
+	st.Expect(t, editor.SetContent("p.ad", "<i>removed</i>"), nil)
+
+	res := &http.Response{Header: http.Header{"Content-Type": {"text/html"}}}
+	body, err := ioutil.ReadAll(editor.Stream(res, strings.NewReader(
+		`<ul><li>one<li>two</ul><dl><dt>a<dd>b<dt>c<dd>d</dl>`+
+			`<table><tr><td>1<td><p>2<tr><td>3</table>`+
+			`<select><option>x<option>y</select><p class="ad">Buy<p>Next</p>`)))
+	st.Expect(t, err, nil)
+	st.Expect(t, string(body), `<ul><li class="child">one<li class="child">two</ul>`+
+		`<dl><dt>a<dd class="child">b<dt>c<dd class="child">d</dl>`+
+		`<table><tr><td class="child">1<td class="child"><p>2<tr><td class="child">3</table>`+
+		`<select><option class="child">x<option class="child">y</select><p class="ad"><i>removed</i><p>Next</p>`)
+}
+
+func TestHTMLEditorStreamFlush(t *testing.T) {
+	for _, contentType := range []string{"text/html", "text/html; charset=iso-8859-1"} {
+		next := make(chan struct{})
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Write([]byte("<html><head><title>Caf\xe9</title></head>"))
+			w.(http.Flusher).Flush()
+			<-next
+			w.Write([]byte("<body><p class=\"ad\">Buy</p></body></html>"))
+		})
+		server := httptest.NewServer(ResponseStream(newHTMLEditor(t).Stream)(handler))
+
+		// The header is sent before the first 1024 bytes of the document are written
+		res, err := http.Get(server.URL)
+		st.Assert(t, err, nil)
+		st.Expect(t, res.Header.Get("Content-Type"), "text/html; charset=utf-8")
+		close(next)
+		body, err := ioutil.ReadAll(res.Body)
+		st.Expect(t, err, nil)
+		st.Expect(t, string(body), `<html><head><title>Café</title><link rel="stylesheet" href="/style.css"></head>`+
+			`<body><p class="ad"><i>removed</i></p><script src="/analytics.js"></script></body></html>`)
+		res.Body.Close()
+		server.Close()
+	}
+}
@@ -0,0 +1,779 @@
+package intercept
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidJSONPath is returned when a JSON path cannot be parsed.
+	ErrInvalidJSONPath = errors.New("intercept: invalid JSON path")
+
+	// ErrJSONPathNotFound is returned when a JSON path does not exist in the body.
+	ErrJSONPathNotFound = errors.New("intercept: JSON path not found")
+
+	// ErrInvalidJSONPatch is returned when a JSON patch document is malformed.
+	ErrInvalidJSONPatch = errors.New("intercept: invalid JSON patch")
+
+	// ErrJSONPatchTest is returned when a JSON patch test operation fails.
+	ErrJSONPatchTest = errors.New("intercept: JSON patch test failed")
+)
+
+// JSONGet returns the value at the given path of the current http.Request JSON body.
+// Paths are JSON Pointers (e.g: "/user/items/0/id") or simple JSONPath expressions
+// (e.g: "$.user.items[0].id"). Numbers are returned as json.Number to keep their precision.
+func (s *RequestModifier) JSONGet(path string) (interface{}, error) {
+	buf, err := s.readText()
+	if err != nil {
+		return nil, err
+	}
+	return getJSON(buf, path)
+}
+
+// JSONSet sets the given value at the given path of the current http.Request JSON body,
+// creating any missing intermediate object.
+func (s *RequestModifier) JSONSet(path string, value interface{}) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return setJSONPath(doc, path, value)
+	})
+}
+
+// JSONDelete removes the value at the given path of the current http.Request JSON body.
+func (s *RequestModifier) JSONDelete(path string) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return deleteJSONPath(doc, path)
+	})
+}
+
+// JSONPatch applies the given RFC 6902 JSON Patch document to the current http.Request JSON body.
+// The body is left untouched if any operation fails.
+func (s *RequestModifier) JSONPatch(patch []byte) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return applyJSONPatch(doc, patch)
+	})
+}
+
+// JSONMergePatch applies the given RFC 7386 JSON merge patch to the current http.Request JSON body.
+func (s *RequestModifier) JSONMergePatch(patch []byte) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return applyJSONMergePatch(doc, patch)
+	})
+}
+
+// editJSON reads the current http.Request JSON body, transforms it with the given function
+// and sets the result as the new body.
+func (s *RequestModifier) editJSON(fn func(interface{}) (interface{}, error)) error {
+	buf, err := s.readText()
+	if err != nil {
+		return err
+	}
+	if buf, err = transformJSON(buf, fn); err != nil {
+		return err
+	}
+	s.setText(buf)
+	return nil
+}
+
+// JSONGet returns the value at the given path of the current http.Response JSON body.
+// Paths are JSON Pointers (e.g: "/user/items/0/id") or simple JSONPath expressions
+// (e.g: "$.user.items[0].id"). Numbers are returned as json.Number to keep their precision.
+func (s *ResponseModifier) JSONGet(path string) (interface{}, error) {
+	buf, err := s.readText()
+	if err != nil {
+		return nil, err
+	}
+	return getJSON(buf, path)
+}
+
+// JSONSet sets the given value at the given path of the current http.Response JSON body,
+// creating any missing intermediate object.
+func (s *ResponseModifier) JSONSet(path string, value interface{}) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return setJSONPath(doc, path, value)
+	})
+}
+
+// JSONDelete removes the value at the given path of the current http.Response JSON body.
+func (s *ResponseModifier) JSONDelete(path string) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return deleteJSONPath(doc, path)
+	})
+}
+
+// JSONPatch applies the given RFC 6902 JSON Patch document to the current http.Response JSON body.
+// The body is left untouched if any operation fails.
+func (s *ResponseModifier) JSONPatch(patch []byte) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return applyJSONPatch(doc, patch)
+	})
+}
+
+// JSONMergePatch applies the given RFC 7386 JSON merge patch to the current http.Response JSON body.
+func (s *ResponseModifier) JSONMergePatch(patch []byte) error {
+	return s.editJSON(func(doc interface{}) (interface{}, error) {
+		return applyJSONMergePatch(doc, patch)
+	})
+}
+
+// editJSON reads the current http.Response JSON body, transforms it with the given function
+// and sets the result as the new body.
+func (s *ResponseModifier) editJSON(fn func(interface{}) (interface{}, error)) error {
+	buf, err := s.readText()
+	if err != nil {
+		return err
+	}
+	if buf, err = transformJSON(buf, fn); err != nil {
+		return err
+	}
+	s.setText(buf)
+	return nil
+}
+
+// jsonObject represents a JSON object preserving the original order of its keys.
+type jsonObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newJSONObject() *jsonObject {
+	return &jsonObject{values: make(map[string]interface{})}
+}
+
+func (o *jsonObject) get(key string) (interface{}, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+// set sets the given key value, keeping its position if the key already exists.
+func (o *jsonObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *jsonObject) del(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+// parseJSON parses the given JSON document into ordered objects, slices,
+// json.Number, string, bool and nil values. An empty document is parsed as null.
+func parseJSON(data []byte) (interface{}, error) {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	value, err := parseJSONValue(decoder)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("intercept: invalid JSON: unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+func parseJSONValue(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		object := newJSONObject()
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			object.set(key.(string), value)
+		}
+		_, err := decoder.Token()
+		return object, err
+	case json.Delim('['):
+		array := []interface{}{}
+		for decoder.More() {
+			value, err := parseJSONValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	}
+
+	return token, nil
+}
+
+// toJSONValue converts the given Go value into the ordered JSON representation.
+func toJSONValue(value interface{}) (interface{}, error) {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return parseJSON(buf)
+}
+
+// fromJSONValue converts the given ordered JSON value into plain Go maps and slices.
+func fromJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *jsonObject:
+		object := make(map[string]interface{}, len(v.keys))
+		for _, key := range v.keys {
+			object[key] = fromJSONValue(v.values[key])
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = fromJSONValue(item)
+		}
+		return array
+	}
+	return value
+}
+
+// encodeJSON writes the given ordered JSON value into the buffer.
+func encodeJSON(buf *bytes.Buffer, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		buf.WriteString(string(v))
+	case string:
+		return encodeJSONString(buf, v)
+	case *jsonObject:
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSONString(buf, key); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := encodeJSON(buf, v.values[key]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	default:
+		return fmt.Errorf("intercept: unsupported JSON value type %T", value)
+	}
+	return nil
+}
+
+// encodeJSONString writes the given string as JSON without escaping HTML characters.
+func encodeJSONString(buf *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	// Remove the newline appended by the encoder
+	buf.Truncate(buf.Len() - 1)
+	return nil
+}
+
+// transformJSON parses the given JSON document, transforms it with the given function and encodes it back.
+func transformJSON(body []byte, fn func(interface{}) (interface{}, error)) ([]byte, error) {
+	doc, err := parseJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	if doc, err = fn(doc); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encodeJSON(buf, doc); err != nil {
+		return nil, err
+	}
+	if bytes.HasSuffix(body, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes(), nil
+}
+
+// getJSON returns the value at the given path of the JSON document.
+func getJSON(body []byte, path string) (interface{}, error) {
+	doc, err := parseJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	value, err := jsonGet(doc, tokens)
+	if err != nil {
+		return nil, err
+	}
+	return fromJSONValue(value), nil
+}
+
+func setJSONPath(doc interface{}, path string, value interface{}) (interface{}, error) {
+	tokens, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if value, err = toJSONValue(value); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	if doc == nil {
+		doc = newJSONObject()
+	}
+	return jsonEdit(doc, tokens, true, func(container interface{}, token string) (interface{}, error) {
+		if array, ok := container.([]interface{}); ok {
+			index, err := jsonArrayIndex(token, len(array), true)
+			if err != nil {
+				return nil, err
+			}
+			if index == len(array) {
+				return append(array, value), nil
+			}
+			array[index] = value
+			return array, nil
+		}
+		return jsonAdd(container, token, value)
+	})
+}
+
+func deleteJSONPath(doc interface{}, path string) (interface{}, error) {
+	tokens, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return jsonRemove(doc, tokens)
+}
+
+// parseJSONPath parses the given JSON Pointer or JSONPath expression into reference tokens.
+// Only JSONPath child member and index selectors are supported.
+func parseJSONPath(path string) ([]string, error) {
+	if !strings.HasPrefix(path, "$") {
+		return parseJSONPointer(path)
+	}
+
+	var tokens []string
+	rest := path[1:]
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" || name == "*" {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, path)
+			}
+			tokens = append(tokens, name)
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest[2:], string(rest[1])+"]")
+			if end == -1 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, path)
+			}
+			tokens = append(tokens, rest[2:end+2])
+			rest = rest[end+4:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, path)
+			}
+			index := rest[1:end]
+			if _, err := strconv.ParseUint(index, 10, 0); err != nil {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, path)
+			}
+			tokens = append(tokens, index)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, path)
+		}
+	}
+	return tokens, nil
+}
+
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+// parseJSONPointer parses the given RFC 6901 JSON Pointer into reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidJSONPath, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = jsonPointerUnescaper.Replace(token)
+	}
+	return tokens, nil
+}
+
+// jsonArrayIndex parses the given array index reference token.
+// If end is true, the index can reference the end of the array, also using "-".
+func jsonArrayIndex(token string, length int, end bool) (int, error) {
+	if end && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidJSONPath, token)
+	}
+	if index > length || (index == length && !end) {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrJSONPathNotFound, index)
+	}
+	return index, nil
+}
+
+// jsonChild returns the child value referenced by the given token.
+func jsonChild(node interface{}, token string) (interface{}, error) {
+	switch v := node.(type) {
+	case *jsonObject:
+		if value, ok := v.get(token); ok {
+			return value, nil
+		}
+	case []interface{}:
+		index, err := jsonArrayIndex(token, len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		return v[index], nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrJSONPathNotFound, token)
+}
+
+// jsonGet returns the value referenced by the given tokens.
+func jsonGet(doc interface{}, tokens []string) (interface{}, error) {
+	for _, token := range tokens {
+		value, err := jsonChild(doc, token)
+		if err != nil {
+			return nil, err
+		}
+		doc = value
+	}
+	return doc, nil
+}
+
+// jsonEdit calls fn with the container of the value referenced by the given tokens,
+// replacing it by the returned one. If create is true, missing intermediate objects are created.
+func jsonEdit(node interface{}, tokens []string, create bool, fn func(interface{}, string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+
+	child, err := jsonChild(node, tokens[0])
+	if err != nil {
+		object, ok := node.(*jsonObject)
+		if !create || !ok {
+			return nil, err
+		}
+		child = newJSONObject()
+		object.set(tokens[0], child)
+	}
+
+	if child, err = jsonEdit(child, tokens[1:], create, fn); err != nil {
+		return nil, err
+	}
+
+	switch v := node.(type) {
+	case *jsonObject:
+		v.set(tokens[0], child)
+	case []interface{}:
+		index, _ := jsonArrayIndex(tokens[0], len(v), false)
+		v[index] = child
+	}
+	return node, nil
+}
+
+// jsonAdd adds the given value in the container, as defined by the JSON Patch add operation.
+func jsonAdd(container interface{}, token string, value interface{}) (interface{}, error) {
+	switch v := container.(type) {
+	case *jsonObject:
+		v.set(token, value)
+		return v, nil
+	case []interface{}:
+		index, err := jsonArrayIndex(token, len(v), true)
+		if err != nil {
+			return nil, err
+		}
+		v = append(v, nil)
+		copy(v[index+1:], v[index:])
+		v[index] = value
+		return v, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrJSONPathNotFound, token)
+}
+
+// jsonRemove removes the value referenced by the given tokens.
+func jsonRemove(doc interface{}, tokens []string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the document root", ErrInvalidJSONPath)
+	}
+	return jsonEdit(doc, tokens, false, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case *jsonObject:
+			if v.del(token) {
+				return v, nil
+			}
+		case []interface{}:
+			index, err := jsonArrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(v[:index], v[index+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrJSONPathNotFound, token)
+	})
+}
+
+// jsonReplace replaces the existing value referenced by the given tokens.
+func jsonReplace(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonEdit(doc, tokens, false, func(container interface{}, token string) (interface{}, error) {
+		switch v := container.(type) {
+		case *jsonObject:
+			if _, ok := v.get(token); ok {
+				v.set(token, value)
+				return v, nil
+			}
+		case []interface{}:
+			index, err := jsonArrayIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			v[index] = value
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: %q", ErrJSONPathNotFound, token)
+	})
+}
+
+// jsonInsert adds the given value at the location referenced by the given tokens.
+func jsonInsert(doc interface{}, tokens []string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonEdit(doc, tokens, false, func(container interface{}, token string) (interface{}, error) {
+		return jsonAdd(container, token, value)
+	})
+}
+
+// jsonClone returns a deep copy of the given value.
+func jsonClone(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *jsonObject:
+		object := newJSONObject()
+		for _, key := range v.keys {
+			object.set(key, jsonClone(v.values[key]))
+		}
+		return object
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = jsonClone(item)
+		}
+		return array
+	}
+	return value
+}
+
+// jsonEqual reports whether the given values are equal as defined by the JSON Patch test operation.
+func jsonEqual(a, b interface{}) bool {
+	switch x := a.(type) {
+	case *jsonObject:
+		y, ok := b.(*jsonObject)
+		if !ok || len(x.keys) != len(y.keys) {
+			return false
+		}
+		for _, key := range x.keys {
+			value, ok := y.get(key)
+			if !ok || !jsonEqual(x.values[key], value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !jsonEqual(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		m, okx := new(big.Rat).SetString(string(x))
+		n, oky := new(big.Rat).SetString(string(y))
+		return okx && oky && m.Cmp(n) == 0
+	}
+	return a == b
+}
+
+// applyJSONPatch applies the given RFC 6902 JSON Patch document.
+func applyJSONPatch(doc interface{}, patch []byte) (interface{}, error) {
+	value, err := parseJSON(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJSONPatch, err)
+	}
+	operations, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: document must be an array", ErrInvalidJSONPatch)
+	}
+
+	for i, item := range operations {
+		operation, ok := item.(*jsonObject)
+		if !ok {
+			return nil, fmt.Errorf("%w: operation %d must be an object", ErrInvalidJSONPatch, i)
+		}
+		if doc, err = applyJSONOperation(doc, operation); err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+	return doc, nil
+}
+
+// applyJSONOperation applies a single JSON Patch operation.
+func applyJSONOperation(doc interface{}, operation *jsonObject) (interface{}, error) {
+	op, _ := operation.values["op"].(string)
+	path, ok := operation.values["path"].(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing path", ErrInvalidJSONPatch)
+	}
+	tokens, err := parseJSONPointer(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value, hasValue := operation.get("value")
+	if !hasValue && (op == "add" || op == "replace" || op == "test") {
+		return nil, fmt.Errorf("%w: missing value", ErrInvalidJSONPatch)
+	}
+
+	var from []string
+	if op == "move" || op == "copy" {
+		pointer, ok := operation.values["from"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidJSONPatch)
+		}
+		if from, err = parseJSONPointer(pointer); err != nil {
+			return nil, err
+		}
+		if value, err = jsonGet(doc, from); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op {
+	case "add":
+		return jsonInsert(doc, tokens, value)
+	case "remove":
+		return jsonRemove(doc, tokens)
+	case "replace":
+		return jsonReplace(doc, tokens, value)
+	case "move":
+		if strings.HasPrefix(path, operation.values["from"].(string)+"/") {
+			return nil, fmt.Errorf("%w: cannot move a value into itself", ErrInvalidJSONPatch)
+		}
+		if len(from) == 0 {
+			return jsonInsert(doc, tokens, value)
+		}
+		if doc, err = jsonRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return jsonInsert(doc, tokens, value)
+	case "copy":
+		return jsonInsert(doc, tokens, jsonClone(value))
+	case "test":
+		current, err := jsonGet(doc, tokens)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrJSONPatchTest, path)
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown operation %q", ErrInvalidJSONPatch, op)
+}
+
+// applyJSONMergePatch applies the given RFC 7386 JSON merge patch.
+func applyJSONMergePatch(doc interface{}, patch []byte) (interface{}, error) {
+	value, err := parseJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+	return jsonMerge(doc, value), nil
+}
+
+func jsonMerge(target, patch interface{}) interface{} {
+	object, ok := patch.(*jsonObject)
+	if !ok {
+		return patch
+	}
+
+	result, ok := target.(*jsonObject)
+	if !ok {
+		result = newJSONObject()
+	}
+	for _, key := range object.keys {
+		value := object.values[key]
+		if value == nil {
+			result.del(key)
+			continue
+		}
+		current, _ := result.get(key)
+		result.set(key, jsonMerge(current, value))
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+package intercept
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const jsonDocument = `{"id":12345678901234567890,"name":"Rick","tags":["a","b"],"meta":{"z":1,"a":2}}`
+
+func jsonRequest(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	return req
+}
+
+func TestJSONGet(t *testing.T) {
+	modifier := NewRequestModifier(jsonRequest(jsonDocument))
+
+	value, err := modifier.JSONGet("/id")
+	st.Expect(t, err, nil)
+	st.Expect(t, value, json.Number("12345678901234567890"))
+
+	value, err = modifier.JSONGet("$.tags[1]")
+	st.Expect(t, err, nil)
+	st.Expect(t, value, "b")
+
+	value, err = modifier.JSONGet("$['meta'].a")
+	st.Expect(t, err, nil)
+	st.Expect(t, value, json.Number("2"))
+
+	value, err = modifier.JSONGet("/meta")
+	st.Expect(t, err, nil)
+	st.Expect(t, value, map[string]interface{}{"z": json.Number("1"), "a": json.Number("2")})
+
+	_, err = modifier.JSONGet("/missing")
+	st.Expect(t, errors.Is(err, ErrJSONPathNotFound), true)
+
+	_, err = modifier.JSONGet("$.tags[*]")
+	st.Expect(t, errors.Is(err, ErrInvalidJSONPath), true)
+}
+
+func TestJSONSet(t *testing.T) {
+	req := jsonRequest(jsonDocument)
+	modifier := NewRequestModifier(req)
+	st.Expect(t, modifier.JSONSet("/name", "Morty"), nil)
+	st.Expect(t, modifier.JSONSet("$.meta.extra.source", "proxy"), nil)
+	st.Expect(t, modifier.JSONSet("/tags/-", "c"), nil)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), `{"id":12345678901234567890,"name":"Morty","tags":["a","b","c"],"meta":{"z":1,"a":2,"extra":{"source":"proxy"}}}`)
+	st.Expect(t, req.ContentLength, int64(len(body)))
+}
+
+func TestJSONDelete(t *testing.T) {
+	req := jsonRequest(jsonDocument)
+	modifier := NewRequestModifier(req)
+	st.Expect(t, modifier.JSONDelete("/meta/z"), nil)
+	st.Expect(t, modifier.JSONDelete("$.tags[0]"), nil)
+	st.Expect(t, errors.Is(modifier.JSONDelete("/unknown"), ErrJSONPathNotFound), true)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), `{"id":12345678901234567890,"name":"Rick","tags":["b"],"meta":{"a":2}}`)
+}
+
+func TestJSONPatch(t *testing.T) {
+	req := jsonRequest(jsonDocument)
+	modifier := NewRequestModifier(req)
+	err := modifier.JSONPatch([]byte(`[
+		{"op": "test", "path": "/id", "value": 12345678901234567890},
+		{"op": "replace", "path": "/name", "value": "Morty"},
+		{"op": "add", "path": "/tags/0", "value": "first"},
+		{"op": "remove", "path": "/meta/z"},
+		{"op": "copy", "from": "/meta", "path": "/copy"},
+		{"op": "move", "from": "/copy/a", "path": "/moved"}
+	]`))
+	st.Expect(t, err, nil)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), `{"id":12345678901234567890,"name":"Morty","tags":["first","a","b"],"meta":{"a":2},"copy":{},"moved":2}`)
+}
+
+func TestJSONPatchFailure(t *testing.T) {
+	req := jsonRequest(jsonDocument)
+	modifier := NewRequestModifier(req)
+	err := modifier.JSONPatch([]byte(`[
+		{"op": "replace", "path": "/name", "value": "Morty"},
+		{"op": "test", "path": "/tags/0", "value": "z"}
+	]`))
+	st.Expect(t, errors.Is(err, ErrJSONPatchTest), true)
+
+	body, _ := ioutil.ReadAll(req.Body)
+	st.Expect(t, string(body), jsonDocument)
+
+	err = modifier.JSONPatch([]byte(`{"op": "add"}`))
+	st.Expect(t, errors.Is(err, ErrInvalidJSONPatch), true)
+
+	err = modifier.JSONPatch([]byte(`[{"op": "unknown", "path": "/id"}]`))
+	st.Expect(t, errors.Is(err, ErrInvalidJSONPatch), true)
+}
+
+func TestJSONMergePatch(t *testing.T) {
+	res := &http.Response{Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(jsonDocument + "\n"))}
+	modifier := NewResponseModifier(nil, res)
+	err := modifier.JSONMergePatch([]byte(`{"name":"Morty","tags":null,"meta":{"z":null,"b":[1.50]}}`))
+	st.Expect(t, err, nil)
+
+	body, _ := ioutil.ReadAll(res.Body)
+	st.Expect(t, string(body), `{"id":12345678901234567890,"name":"Morty","meta":{"a":2,"b":[1.50]}}`+"\n")
+	st.Expect(t, res.ContentLength, int64(len(body)))
+}
+
+func TestJSONPatchEncodedBody(t *testing.T) {
+	res := &http.Response{Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader(""))}
+	res.Header.Set("Content-Encoding", "gzip")
+	modifier := NewResponseModifier(nil, res)
+	modifier.Bytes([]byte(`{"html":"<b>"}`))
+
+	st.Expect(t, modifier.JSONSet("/url", "http://a.com/?a=1&b=2"), nil)
+	body, err := modifier.ReadString()
+	st.Expect(t, err, nil)
+	st.Expect(t, body, `{"html":"<b>","url":"http://a.com/?a=1&b=2"}`)
+}
@@ -0,0 +1,123 @@
+package intercept
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// ErrBodyUnavailable is returned by the body methods of lazy response modifiers
+// when the response body will not be buffered, such as when the client went away.
+var ErrBodyUnavailable = errors.New("intercept: response body unavailable")
+
+// lazyModifier runs a response modifier as soon as the response header is known,
+// deferring the response body buffering until the modifier calls a body method.
+type lazyModifier struct {
+	once      sync.Once
+	requested chan struct{}
+	ready     chan struct{}
+	done      chan struct{}
+	status    int
+	header    http.Header
+	modifier  *ResponseModifier
+	err       error
+	panic     interface{}
+	bodyErr   error
+}
+
+// startLazyModifier calls the given modifier function in a separate goroutine,
+// and waits until it returns or calls a body method.
+// It returns true if the modifier requested the response body.
+func startLazyModifier(modifier *ResponseModifier, fn ResModifierFuncE) (*lazyModifier, bool) {
+	l := &lazyModifier{
+		requested: make(chan struct{}),
+		ready:     make(chan struct{}),
+		done:      make(chan struct{}),
+		status:    modifier.Response.StatusCode,
+		header:    modifier.Response.Header.Clone(),
+		modifier:  modifier,
+	}
+	modifier.lazy = l
+	modifier.Response.Body = lazyReader{modifier}
+
+	go func() {
+		defer close(l.done)
+		defer func() {
+			if p := recover(); p != nil {
+				l.panic = p
+			}
+		}()
+		l.err = fn(modifier)
+	}()
+
+	select {
+	case <-l.requested:
+		return l, true
+	case <-l.done:
+		l.rethrow()
+		return l, false
+	}
+}
+
+// load requests the response body, blocking until it is buffered.
+func (l *lazyModifier) load() error {
+	l.once.Do(func() { close(l.requested) })
+	<-l.ready
+	return l.bodyErr
+}
+
+// resume provides the buffered response body to the modifier and waits until it returns.
+func (l *lazyModifier) resume() error {
+	close(l.ready)
+	<-l.done
+	l.rethrow()
+	return l.err
+}
+
+// abort unblocks the modifier waiting for the response body, which will not be provided,
+// and waits until it returns.
+func (l *lazyModifier) abort() {
+	select {
+	case <-l.ready:
+	default:
+		l.bodyErr = ErrBodyUnavailable
+		close(l.ready)
+	}
+	<-l.done
+}
+
+// restore restores the original status and header of the response modified by the modifier.
+func (l *lazyModifier) restore(res *http.Response) {
+	res.StatusCode = l.status
+	res.Status = strconv.Itoa(l.status) + " " + http.StatusText(l.status)
+	res.Header = l.header
+}
+
+// rethrow propagates a panic of the modifier to the calling goroutine.
+func (l *lazyModifier) rethrow() {
+	if l.panic != nil {
+		panic(l.panic)
+	}
+}
+
+// lazyReader is the placeholder body of lazy response modifiers,
+// which loads the response body on the first read.
+type lazyReader struct {
+	modifier *ResponseModifier
+}
+
+func (r lazyReader) Read(p []byte) (int, error) {
+	if err := r.modifier.loadBody(); err != nil {
+		return 0, err
+	}
+	if body := r.modifier.Response.Body; body != nil && body != io.ReadCloser(r) {
+		return body.Read(p)
+	}
+	return 0, io.EOF
+}
+
+func (r lazyReader) Close() error {
+	return nil
+}
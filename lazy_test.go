@@ -0,0 +1,146 @@
+package intercept
+
+import (
+	"context"
+	"errors"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func lazyInterceptor(fn ResModifierFuncE) *ResponseInterceptor {
+	interceptor := ResponseE(fn)
+	interceptor.LazyBuffering = true
+	return interceptor
+}
+
+func TestLazyBufferingHeaderOnly(t *testing.T) {
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		m.Header.Set("X-Modified", "true")
+		return nil
+	})
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+		rw.Write([]byte(" world"))
+	})
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("X-Modified"), "true")
+	st.Expect(t, w.Body.String(), "Hello world")
+}
+
+func TestLazyBufferingStreamsBody(t *testing.T) {
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	interceptor.HandleHTTP(w, req, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+		// The body is written before the handler is done
+		st.Expect(t, w.Body.String(), "Hello")
+	}))
+	st.Expect(t, w.Body.String(), "Hello")
+}
+
+func TestLazyBufferingBody(t *testing.T) {
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		m.Header.Set("X-Modified", "true")
+		if m.Header.Get("Content-Type") != "text/plain" {
+			return nil
+		}
+		body, err := m.ReadString()
+		if err != nil {
+			return err
+		}
+		m.String(strings.ToUpper(body))
+		return nil
+	})
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.Write([]byte("Hello"))
+		rw.Write([]byte(" world"))
+	})
+	st.Expect(t, w.Header().Get("X-Modified"), "true")
+	st.Expect(t, w.Header().Get("Content-Length"), "11")
+	st.Expect(t, w.Body.String(), "HELLO WORLD")
+
+	// Reading the body field loads it too
+	interceptor = lazyInterceptor(func(m *ResponseModifier) error {
+		body, err := ioutil.ReadAll(m.Response.Body)
+		st.Expect(t, err, nil)
+		st.Expect(t, string(body), "Hello world")
+		m.Bytes(body)
+		return nil
+	})
+	w = serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello world"))
+	})
+	st.Expect(t, w.Body.String(), "Hello world")
+}
+
+func TestLazyBufferingError(t *testing.T) {
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		return errors.New("oops")
+	})
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+	})
+	st.Expect(t, w.Code, 500)
+
+	// Falls back to the unmodified response
+	interceptor = lazyInterceptor(func(m *ResponseModifier) error {
+		m.Header.Set("X-Modified", "true")
+		m.Status(201)
+		if _, err := m.ReadBytes(); err != nil {
+			return err
+		}
+		return errors.New("oops")
+	})
+	interceptor.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) bool {
+		return false
+	}
+	w = serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+	})
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Header().Get("X-Modified"), "")
+	st.Expect(t, w.Body.String(), "Hello")
+}
+
+func TestLazyBufferingPanic(t *testing.T) {
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		panic("oops")
+	})
+
+	defer func() {
+		st.Expect(t, recover(), "oops")
+	}()
+	serve(interceptor, httptest.NewRequest("GET", "/", nil), func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+	})
+	t.Error("the panic should be propagated")
+}
+
+func TestLazyBufferingCanceledContext(t *testing.T) {
+	var bodyErr error
+	interceptor := lazyInterceptor(func(m *ResponseModifier) error {
+		_, bodyErr = m.ReadBytes()
+		return bodyErr
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/", nil)
+	w := httptest.NewRecorder()
+	interceptor.HandleHTTP(w, req, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("Hello"))
+		cancel()
+	}))
+	st.Expect(t, bodyErr, ErrBodyUnavailable)
+	st.Expect(t, w.Body.String(), "")
+}
@@ -0,0 +1,73 @@
+package intercept
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// OverflowPolicy defines how interceptors handle bodies larger than their maximum body size.
+type OverflowPolicy int
+
+const (
+	// RejectOverflow replies with a 413 Request Entity Too Large error to requests,
+	// or a 502 Bad Gateway error to responses, unless an ErrorHandler is defined.
+	RejectOverflow OverflowPolicy = iota
+
+	// PassthroughOverflow skips the modification, streaming the body untouched.
+	PassthroughOverflow
+
+	// SpillOverflow buffers the body in a temporary file. Reading the body in memory
+	// fails with a BodyTooLargeError, but it can still be modified as a stream.
+	SpillOverflow
+)
+
+// BodyTooLargeError is returned when a body exceeds the maximum size allowed by the interceptor.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Error returns the error message.
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("intercept: body exceeds the maximum size of %d bytes", e.Limit)
+}
+
+// readBody reads the whole given body in memory, up to the given size limit if greater than zero.
+// It returns the bytes read and a new body that reads the whole original content.
+// If the body exceeds the limit, a BodyTooLargeError is returned.
+func readBody(body io.ReadCloser, limit int64) ([]byte, io.ReadCloser, error) {
+	if limit <= 0 {
+		buf, err := ioutil.ReadAll(body)
+		if err != nil {
+			return nil, body, err
+		}
+		return buf, ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+
+	buf, err := ioutil.ReadAll(limitReader(body, limit))
+	if err != nil {
+		return nil, body, err
+	}
+	if err := checkLimit(int64(len(buf)), limit); err != nil {
+		return nil, &readCloser{io.MultiReader(bytes.NewReader(buf), body), body}, err
+	}
+	return buf, ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+// limitReader returns a reader that stops one byte past the given size limit, if greater than zero,
+// so exceeding content can be detected without reading it whole.
+func limitReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return io.LimitReader(r, limit+1)
+}
+
+// checkLimit returns a BodyTooLargeError if the given size exceeds the limit, if greater than zero.
+func checkLimit(size, limit int64) error {
+	if limit > 0 && size > limit {
+		return &BodyTooLargeError{Limit: limit}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package intercept
+
+import (
+	"bytes"
+	"errors"
+	"github.com/nbio/st"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// chunkedRequest creates a request with an unknown body length.
+func chunkedRequest(body string) *http.Request {
+	req, _ := http.NewRequest("POST", "http://example.com/", ioutil.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	return req
+}
+
+func TestRequestRejectOverflow(t *testing.T) {
+	interceptor := Request(func(m *RequestModifier) {
+		t.Error("modifier should not be called")
+	})
+	interceptor.MaxBodySize = 4
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("Hello"))
+	w := serve(interceptor, req, failHandler(t))
+	st.Expect(t, w.Code, 413)
+}
+
+func TestRequestRejectOverflowUnknownLength(t *testing.T) {
+	interceptor := RequestE(func(m *RequestModifier) error {
+		_, err := m.ReadBytes()
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+		st.Expect(t, tooLarge.Limit, int64(4))
+		return err
+	})
+	interceptor.MaxBodySize = 4
+
+	w := serve(interceptor, chunkedRequest("Hello"), failHandler(t))
+	st.Expect(t, w.Code, 413)
+
+	// Errors swallowed by non-failing modifiers are rejected too
+	interceptor = Request(func(m *RequestModifier) {
+		m.ReadString()
+	})
+	interceptor.MaxBodySize = 4
+	w = serve(interceptor, chunkedRequest("Hello"), failHandler(t))
+	st.Expect(t, w.Code, 413)
+}
+
+func TestRequestPassthroughOverflow(t *testing.T) {
+	calls := 0
+	interceptor := RequestE(func(m *RequestModifier) error {
+		calls++
+		if _, err := m.ReadBytes(); err != nil {
+			return err
+		}
+		m.String("modified")
+		return nil
+	})
+	interceptor.MaxBodySize = 4
+	interceptor.Overflow = PassthroughOverflow
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}
+
+	req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader("Hello"))
+	st.Expect(t, serve(interceptor, req, handler).Body.String(), "Hello")
+	st.Expect(t, calls, 0)
+
+	st.Expect(t, serve(interceptor, chunkedRequest("Hello"), handler).Body.String(), "Hello")
+	st.Expect(t, calls, 1)
+
+	st.Expect(t, serve(interceptor, chunkedRequest("Hey"), handler).Body.String(), "modified")
+}
+
+func TestRequestSpillOverflow(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	interceptor := RequestE(func(m *RequestModifier) error {
+		_, err := m.ReadBytes()
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+		return nil
+	})
+	interceptor.MaxBodySize = 4
+	interceptor.Overflow = SpillOverflow
+
+	w := serve(interceptor, chunkedRequest("Hello world"), func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		w.Write(body)
+	})
+	st.Expect(t, w.Body.String(), "Hello world")
+
+	files, _ := ioutil.ReadDir(os.TempDir())
+	st.Expect(t, len(files), 0)
+}
+
+func TestResponseRejectOverflow(t *testing.T) {
+	interceptor := NewResponseInterceptor(func(m *ResponseModifier) {
+		t.Error("modifier should not be called")
+	})
+	interceptor.MaxBodySize = 4
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write([]byte("Hello"))
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+	})
+	st.Expect(t, w.Code, 502)
+}
+
+func TestResponsePassthroughOverflow(t *testing.T) {
+	interceptor := NewResponseInterceptor(func(m *ResponseModifier) {
+		m.String("modified")
+	})
+	interceptor.MaxBodySize = 4
+	interceptor.Overflow = PassthroughOverflow
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hel"))
+		w.Write([]byte("lo"))
+	})
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Body.String(), "Hello")
+
+	// Announced larger bodies are not buffered
+	w = serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(201)
+		io.Copy(w, strings.NewReader("Hello"))
+	})
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Body.String(), "Hello")
+
+	// Smaller bodies are modified
+	w = serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hey"))
+	})
+	st.Expect(t, w.Body.String(), "modified")
+}
+
+func TestResponseSpillOverflow(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	interceptor := ResponseE(func(m *ResponseModifier) error {
+		_, err := m.ReadBytes()
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+
+		// Large bodies can be modified as a stream
+		body, _ := ioutil.ReadAll(m.Response.Body)
+		return m.Reader(bytes.NewReader(bytes.ToUpper(body)))
+	})
+	interceptor.MaxBodySize = 4
+	interceptor.Overflow = SpillOverflow
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello "))
+		w.Write([]byte("world"))
+	})
+	st.Expect(t, w.Body.String(), "HELLO WORLD")
+	st.Expect(t, w.Header().Get("Content-Length"), "11")
+
+	files, _ := ioutil.ReadDir(os.TempDir())
+	st.Expect(t, len(files), 0)
+
+	// Unmodified spilled bodies are streamed untouched
+	interceptor.ModifierE = nil
+	w = serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello world"))
+	})
+	st.Expect(t, w.Body.String(), "Hello world")
+	st.Expect(t, w.Header().Get("Content-Length"), "11")
+}
+
+func TestDecompressionBomb(t *testing.T) {
+	// A ~100 KB gzip body, under the limit, that decompresses to 50 MiB
+	bomb := gzipBytes(strings.Repeat("\x00", 50<<20))
+	st.Expect(t, len(bomb) < 1<<20, true)
+
+	newRequest := func() *http.Request {
+		req, _ := http.NewRequest("POST", "http://example.com/", bytes.NewReader(bomb))
+		req.Header.Set("Content-Encoding", "gzip")
+		return req
+	}
+
+	interceptor := Request(func(m *RequestModifier) {
+		_, err := m.ReadBytes()
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+		st.Expect(t, tooLarge.Limit, int64(1<<20))
+	})
+	interceptor.MaxBodySize = 1 << 20
+	st.Expect(t, serve(interceptor, newRequest(), failHandler(t)).Code, 413)
+
+	// Seekable bodies are limited too, even if buffered in temporary files
+	t.Setenv("TMPDIR", t.TempDir())
+	interceptor = Request(func(m *RequestModifier) {
+		_, err := m.ReadSeeker()
+		var tooLarge *BodyTooLargeError
+		st.Expect(t, errors.As(err, &tooLarge), true)
+	})
+	interceptor.MaxBodySize = 1 << 20
+	interceptor.SpillThreshold = 1024
+	st.Expect(t, serve(interceptor, newRequest(), failHandler(t)).Code, 413)
+
+	files, _ := ioutil.ReadDir(os.TempDir())
+	st.Expect(t, len(files), 0)
+
+	var readErr error
+	response := ResponseE(func(m *ResponseModifier) error {
+		_, readErr = m.ReadBytes()
+		return nil
+	})
+	response.MaxBodySize = 1 << 20
+	w := serve(response, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	})
+	var tooLarge *BodyTooLargeError
+	st.Expect(t, errors.As(readErr, &tooLarge), true)
+	st.Expect(t, w.Body.Len(), len(bomb))
+}
@@ -0,0 +1,159 @@
+package intercept
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RewriteURLs returns a middleware that rewrites the URLs of the response headers
+// from the given upstream base URL to the public one, without buffering the response body.
+// See ResponseModifier.RewriteURLs for details.
+func RewriteURLs(upstream, public *url.URL) func(http.Handler) http.Handler {
+	return ResponseHeaders(func(m *ResponseModifier) {
+		m.RewriteURLs(upstream, public)
+	})
+}
+
+// RewriteURLs replaces the given upstream base URL with the public one in the URLs
+// of the Location, Content-Location, Refresh and Link headers of the http.Response,
+// as needed when proxying an upstream server under a different host or path prefix.
+// Absolute URLs are rewritten if they point to the upstream host and path prefix,
+// and absolute paths if they start with the upstream path prefix.
+// Relative paths are kept, since they resolve the same way on both sides.
+func (s *ResponseModifier) RewriteURLs(upstream, public *url.URL) {
+	rewrite := func(ref string) string {
+		return rewriteURL(ref, upstream, public)
+	}
+
+	for _, key := range []string{"Location", "Content-Location"} {
+		editHeader(s.Header, key, rewrite)
+	}
+	editHeader(s.Header, "Refresh", func(v string) string {
+		return rewriteRefresh(v, rewrite)
+	})
+	editHeader(s.Header, "Link", func(v string) string {
+		return rewriteLink(v, rewrite)
+	})
+}
+
+// editHeader replaces every value of the given header with the result of the given function.
+func editHeader(header http.Header, key string, fn func(string) string) {
+	values := header[http.CanonicalHeaderKey(key)]
+	for i, v := range values {
+		values[i] = fn(v)
+	}
+}
+
+// rewriteURL replaces the upstream base URL with the public one in the given URL reference.
+// It returns the reference untouched if it does not refer to the upstream.
+func rewriteURL(ref string, upstream, public *url.URL) string {
+	u, err := url.Parse(ref)
+	if err != nil || u.Opaque != "" {
+		return ref
+	}
+
+	switch {
+	case u.Host != "":
+		if upstream.Host == "" || canonicalHost(u) != canonicalHost(upstream) {
+			return ref
+		}
+		if u.Scheme != "" && !strings.EqualFold(u.Scheme, upstream.Scheme) {
+			return ref
+		}
+	case u.Scheme != "" || !strings.HasPrefix(u.Path, "/"):
+		return ref
+	}
+
+	path, ok := replacePathPrefix(u.Path, upstream.Path, public.Path)
+	if !ok {
+		return ref
+	}
+	if u.RawPath != "" {
+		u.RawPath, _ = replacePathPrefix(u.RawPath, upstream.EscapedPath(), public.EscapedPath())
+	}
+	u.Path = path
+
+	if u.Host != "" {
+		u.Host = public.Host
+		if u.Scheme != "" || public.Host == "" {
+			u.Scheme = public.Scheme
+		}
+	}
+	return u.String()
+}
+
+// rewriteRefresh rewrites the URL of the given Refresh header value, such as "5; url=/foo".
+func rewriteRefresh(value string, rewrite func(string) string) string {
+	i := strings.IndexByte(value, ';')
+	if i < 0 {
+		return value
+	}
+	param := strings.TrimLeft(value[i+1:], " \t")
+	if len(param) < 4 || !strings.EqualFold(param[:3], "url") {
+		return value
+	}
+	ref := strings.TrimLeft(param[3:], " \t")
+	if !strings.HasPrefix(ref, "=") {
+		return value
+	}
+	ref = strings.TrimSpace(ref[1:])
+	start := len(value) - len(ref)
+
+	quote := ""
+	if len(ref) > 1 && (ref[0] == '"' || ref[0] == '\'') && ref[len(ref)-1] == ref[0] {
+		quote, ref = ref[:1], ref[1:len(ref)-1]
+	}
+	return value[:start] + quote + rewrite(ref) + quote
+}
+
+// rewriteLink rewrites the target URLs of the given Link header value,
+// such as `<https://example.com/users?page=2>; rel="next"`.
+func rewriteLink(value string, rewrite func(string) string) string {
+	var b strings.Builder
+	quoted := false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && quoted && i+1 < len(value):
+			b.WriteByte(c)
+			i++
+			c = value[i]
+		case c == '<' && !quoted:
+			end := strings.IndexByte(value[i:], '>')
+			if end < 0 {
+				break
+			}
+			b.WriteByte('<')
+			b.WriteString(rewrite(strings.TrimSpace(value[i+1 : i+end])))
+			i += end
+			c = '>'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// replacePathPrefix replaces the given prefix of the path with the replacement.
+// It returns false if the path does not start with the given prefix.
+func replacePathPrefix(path, prefix, replacement string) (string, bool) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return path, false
+	}
+	return ensureLeadingSlash(strings.TrimSuffix(replacement, "/") + strings.TrimPrefix(path, prefix)), true
+}
+
+// canonicalHost returns the lower case host of the given URL, without the default port of its scheme.
+func canonicalHost(u *url.URL) string {
+	host := strings.ToLower(u.Host)
+	if _, port, err := net.SplitHostPort(host); err == nil {
+		if (port == "80" && u.Scheme != "https") || (port == "443" && u.Scheme == "https") {
+			return host[:len(host)-len(port)-1]
+		}
+	}
+	return host
+}
@@ -0,0 +1,76 @@
+package intercept
+
+import (
+	"github.com/nbio/st"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRewriteURL(t *testing.T) {
+	upstream, _ := url.Parse("http://backend:8080/app/")
+	public, _ := url.Parse("https://example.com/api")
+
+	cases := []struct {
+		ref, expected string
+	}{
+		{"http://backend:8080/app/users?page=2#top", "https://example.com/api/users?page=2#top"},
+		{"http://BACKEND:8080/app", "https://example.com/api"},
+		{"//backend:8080/app/users", "//example.com/api/users"},
+		{"/app/users/a%2Fb", "/api/users/a%2Fb"},
+		{"/app", "/api"},
+		{"users/1", "users/1"},
+		{"/application", "/application"},
+		{"/other", "/other"},
+		{"http://backend:9090/app/users", "http://backend:9090/app/users"},
+		{"https://backend:8080/app/users", "https://backend:8080/app/users"},
+		{"mailto:admin@backend", "mailto:admin@backend"},
+	}
+	for _, c := range cases {
+		st.Expect(t, rewriteURL(c.ref, upstream, public), c.expected)
+	}
+
+	// Default ports and host-only public URLs
+	upstream, _ = url.Parse("http://backend:80")
+	public, _ = url.Parse("/backend")
+	st.Expect(t, rewriteURL("http://backend/users", upstream, public), "/backend/users")
+	st.Expect(t, rewriteURL("/users", upstream, public), "/backend/users")
+}
+
+func TestResponseModifierRewriteURLs(t *testing.T) {
+	upstream, _ := url.Parse("http://backend/app")
+	public, _ := url.Parse("https://example.com/")
+	res := &http.Response{Header: http.Header{
+		"Location":         {"http://backend/app/login"},
+		"Content-Location": {"/app/users/1"},
+		"Refresh":          {"5; URL='/app/home'", "10"},
+		"Link": {
+			`<http://backend/app/users?page=2>; rel="next", </app/style.css>; rel=preload; title="a <b>"`,
+			`<https://cdn.com/app.js>; rel=preload`,
+		},
+	}}
+
+	NewResponseModifier(nil, res).RewriteURLs(upstream, public)
+	st.Expect(t, res.Header.Get("Location"), "https://example.com/login")
+	st.Expect(t, res.Header.Get("Content-Location"), "/users/1")
+	st.Expect(t, res.Header["Refresh"], []string{"5; URL='/home'", "10"})
+	st.Expect(t, res.Header["Link"], []string{
+		`<https://example.com/users?page=2>; rel="next", </style.css>; rel=preload; title="a <b>"`,
+		`<https://cdn.com/app.js>; rel=preload`,
+	})
+}
+
+func TestRewriteURLs(t *testing.T) {
+	upstream, _ := url.Parse("http://backend/app")
+	public, _ := url.Parse("https://example.com/api")
+	handler := RewriteURLs(upstream, public)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://backend/app/login", http.StatusFound)
+	}))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "https://example.com/api/", nil)
+	handler.ServeHTTP(w, req)
+	st.Expect(t, w.Code, 302)
+	st.Expect(t, w.Header().Get("Location"), "https://example.com/api/login")
+}
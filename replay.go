@@ -0,0 +1,248 @@
+package intercept
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoRecordedResponse is returned when no recorded entry matches the intercepted request.
+var ErrNoRecordedResponse = errors.New("intercept: no recorded response matches the request")
+
+// HARMatcher defines the function interface used to match intercepted requests with recorded entries.
+// The given body is the decoded request body.
+type HARMatcher func(r *http.Request, body []byte, entry *HAREntry) bool
+
+// DefaultMatchers are the matchers used when a Replay defines none.
+var DefaultMatchers = []HARMatcher{MatchMethod, MatchPath, MatchQuery, MatchBody}
+
+// MatchMethod matches requests with the same HTTP method as the recorded one.
+func MatchMethod(r *http.Request, body []byte, entry *HAREntry) bool {
+	return r.Method == entry.Request.Method
+}
+
+// MatchPath matches requests with the same URL path as the recorded one.
+func MatchPath(r *http.Request, body []byte, entry *HAREntry) bool {
+	u, err := url.Parse(entry.Request.URL)
+	return err == nil && u.Path == r.URL.Path
+}
+
+// MatchQuery matches requests with the same URL query parameters as the recorded one, in any order.
+func MatchQuery(r *http.Request, body []byte, entry *HAREntry) bool {
+	u, err := url.Parse(entry.Request.URL)
+	if err != nil {
+		return false
+	}
+	query, recorded := r.URL.Query(), u.Query()
+	return (len(query) == 0 && len(recorded) == 0) || reflect.DeepEqual(query, recorded)
+}
+
+// MatchBody matches requests whose body is equal to the recorded one.
+// Bodies are compared by the hash of the original body if recorded by HARCapture,
+// which is not affected by redactors. Requests whose body was not captured never match.
+func MatchBody(r *http.Request, body []byte, entry *HAREntry) bool {
+	data := entry.Request.PostData
+	if data == nil {
+		return len(body) == 0 && !strings.HasPrefix(entry.Request.Comment, harNotCaptured)
+	}
+	if strings.HasPrefix(data.Comment, harBodyHashPrefix) {
+		return harBodyHash(body) == data.Comment
+	}
+	return bytes.Equal(body, decodeHARText(data.Text, data.Encoding))
+}
+
+// MatchHeaders returns a HARMatcher that matches requests with the same values
+// as the recorded ones for the given header fields.
+func MatchHeaders(names ...string) HARMatcher {
+	return func(r *http.Request, body []byte, entry *HAREntry) bool {
+		for _, name := range names {
+			recorded := ""
+			for _, header := range entry.Request.Headers {
+				if http.CanonicalHeaderKey(header.Name) == http.CanonicalHeaderKey(name) {
+					recorded = header.Value
+					break
+				}
+			}
+			if r.Header.Get(name) != recorded {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// LoadHAR reads the entries recorded in the given HAR file.
+func LoadHAR(path string) ([]*HAREntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	har := &HAR{}
+	if err := json.NewDecoder(file).Decode(har); err != nil {
+		return nil, err
+	}
+	if har.Log == nil {
+		return nil, errors.New("intercept: invalid HAR file: missing log")
+	}
+	return har.Log.Entries, nil
+}
+
+// Replay replies to the intercepted requests with the first matching recorded response,
+// without calling the next handler. Unmatched requests are passed to the ErrorHandler
+// with ErrNoRecordedResponse, which replies with a Bad Gateway error by default,
+// or recorded using the capture configured with RecordMissing.
+type Replay struct {
+	// Matchers define the conditions to match a recorded entry. If empty, DefaultMatchers are used.
+	Matchers []HARMatcher
+
+	// ErrorHandler handles the unmatched requests.
+	// If it returns false, the request is passed to the next handler.
+	ErrorHandler ErrorHandler
+
+	// MaxBodySize defines the maximum request body size read in memory, in bytes.
+	// Requests with larger bodies are not matched. Zero means no limit.
+	MaxBodySize int64
+
+	mutex   sync.RWMutex
+	entries []*HAREntry
+	capture *HARCapture
+}
+
+// NewReplay creates a new replay interceptor that replies with the given recorded entries.
+func NewReplay(entries []*HAREntry) *Replay {
+	return &Replay{entries: entries, ErrorHandler: ErrorStatus(http.StatusBadGateway)}
+}
+
+// RecordMissing enables the record missing mode: unmatched requests are passed to the next handler
+// and captured with the given HAR capture. Captured entries are replayed for subsequent requests.
+func (p *Replay) RecordMissing(capture *HARCapture) {
+	capture.Sink = harSinks{capture.Sink, p}
+	p.capture = capture
+}
+
+// WriteEntry adds the given entry to the recorded ones.
+// This method implements the HARSink interface.
+func (p *Replay) WriteEntry(entry *HAREntry) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.entries = append(p.entries, entry)
+	return nil
+}
+
+// HandleHTTP handles the middleware call chain, replying with the matching recorded response.
+// This methods implements the middleware layer compatible interface.
+func (p *Replay) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	r = withBodyCache(r)
+	var body []byte
+	overflowed := false
+	if r.Body != nil {
+		modifier := NewRequestModifier(r)
+		modifier.maxBodySize = p.MaxBodySize
+		var err error
+		if body, err = modifier.ReadBytes(); err != nil {
+			var tooLarge *BodyTooLargeError
+			if !errors.As(err, &tooLarge) {
+				handleError(p.ErrorHandler, w, r, err)
+				return
+			}
+			overflowed = true
+		}
+	}
+
+	if !overflowed {
+		if entry := p.match(r, body); entry != nil {
+			replayResponse(w, entry.Response)
+			return
+		}
+	}
+
+	if p.capture != nil {
+		p.capture.HandleHTTP(w, r, h)
+		return
+	}
+	if !handleError(p.ErrorHandler, w, r, ErrNoRecordedResponse) {
+		h.ServeHTTP(w, r)
+	}
+}
+
+// match returns the first recorded entry matching the given request.
+// Entries whose response body was not captured cannot be replayed.
+func (p *Replay) match(r *http.Request, body []byte) *HAREntry {
+	matchers := p.Matchers
+	if len(matchers) == 0 {
+		matchers = DefaultMatchers
+	}
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	for _, entry := range p.entries {
+		if entry.Request == nil || entry.Response == nil ||
+			strings.HasPrefix(entry.Response.Content.Comment, harNotCaptured) {
+			continue
+		}
+		matched := true
+		for _, matcher := range matchers {
+			if !matcher(r, body, entry) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return entry
+		}
+	}
+	return nil
+}
+
+// replayResponse writes the given recorded response in the http.ResponseWriter.
+func replayResponse(w http.ResponseWriter, res *HARResponse) {
+	body := decodeHARText(res.Content.Text, res.Content.Encoding)
+	header := w.Header()
+	for _, field := range res.Headers {
+		header.Add(field.Name, field.Value)
+	}
+
+	// Recorded bodies are stored decoded
+	header.Del("Content-Encoding")
+	header.Del("Transfer-Encoding")
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+
+	w.WriteHeader(res.Status)
+	w.Write(body)
+}
+
+// decodeHARText returns the bytes of the given recorded body text, decoding it if base64 encoded.
+func decodeHARText(text, encoding string) []byte {
+	if encoding == "base64" {
+		if decoded, err := base64.StdEncoding.DecodeString(text); err == nil {
+			return decoded
+		}
+	}
+	return []byte(text)
+}
+
+// harSinks writes the entries in multiple sinks.
+type harSinks []HARSink
+
+func (s harSinks) WriteEntry(entry *HAREntry) error {
+	for _, sink := range s {
+		if sink == nil {
+			continue
+		}
+		if err := sink.WriteEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package intercept
+
+import (
+	"bytes"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func replayEntry(method, url, body string, status int, text string) *HAREntry {
+	entry := &HAREntry{
+		Request: &HARRequest{Method: method, URL: url},
+		Response: &HARResponse{
+			Status:  status,
+			Headers: []HARNameValue{{Name: "Content-Type", Value: "text/plain"}, {Name: "Content-Encoding", Value: "gzip"}},
+			Content: HARContent{Text: text},
+		},
+	}
+	if body != "" {
+		entry.Request.PostData = &HARPostData{Text: body}
+	}
+	return entry
+}
+
+func failHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	replay := NewReplay([]*HAREntry{
+		replayEntry("GET", "http://example.com/users?page=1&sort=name", "", 200, "page 1"),
+		replayEntry("POST", "http://example.com/users", `{"name":"Rick"}`, 201, "created"),
+	})
+
+	req, _ := http.NewRequest("GET", "http://localhost/users?sort=name&page=1", nil)
+	w := serve(replay, req, failHandler(t))
+	st.Expect(t, w.Code, 200)
+	st.Expect(t, w.Body.String(), "page 1")
+	st.Expect(t, w.Header().Get("Content-Type"), "text/plain")
+	st.Expect(t, w.Header().Get("Content-Encoding"), "")
+	st.Expect(t, w.Header().Get("Content-Length"), "6")
+
+	req, _ = http.NewRequest("POST", "http://localhost/users", strings.NewReader(`{"name":"Rick"}`))
+	w = serve(replay, req, failHandler(t))
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Body.String(), "created")
+
+	req, _ = http.NewRequest("POST", "http://localhost/users", strings.NewReader(`{"name":"Morty"}`))
+	w = serve(replay, req, failHandler(t))
+	st.Expect(t, w.Code, 502)
+}
+
+func TestReplayMatchers(t *testing.T) {
+	entry := replayEntry("GET", "http://example.com/", "", 200, "v2")
+	entry.Request.Headers = []HARNameValue{{Name: "accept-version", Value: "2"}}
+	replay := NewReplay([]*HAREntry{entry})
+	replay.Matchers = []HARMatcher{MatchMethod, MatchHeaders("Accept-Version")}
+
+	req, _ := http.NewRequest("GET", "http://localhost/any?path=1", nil)
+	req.Header.Set("Accept-Version", "2")
+	st.Expect(t, serve(replay, req, failHandler(t)).Body.String(), "v2")
+
+	req.Header.Set("Accept-Version", "1")
+	st.Expect(t, serve(replay, req, failHandler(t)).Code, 502)
+}
+
+func TestReplayFallback(t *testing.T) {
+	replay := NewReplay(nil)
+	replay.ErrorHandler = ErrorFallback
+
+	req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader("body"))
+	w := serve(replay, req, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), "body")
+		w.Write([]byte("upstream"))
+	})
+	st.Expect(t, w.Body.String(), "upstream")
+}
+
+func TestReplayRecordMissing(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewHARWriter(buf)
+	replay := NewReplay(nil)
+	replay.RecordMissing(NewHARCapture(writer))
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(202)
+		w.Write([]byte{0xff, 0x00})
+	}
+
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost/binary", nil)
+		w := serve(replay, req, handler)
+		st.Expect(t, w.Code, 202)
+		st.Expect(t, w.Body.Bytes(), []byte{0xff, 0x00})
+	}
+	st.Expect(t, calls, 1)
+
+	// Recorded entries can be replayed from a HAR file
+	writer.Close()
+	file := filepath.Join(t.TempDir(), "recorded.har")
+	ioutil.WriteFile(file, buf.Bytes(), 0644)
+	entries, err := LoadHAR(file)
+	st.Assert(t, err, nil)
+	st.Assert(t, len(entries), 1)
+
+	req, _ := http.NewRequest("GET", "http://localhost/binary", nil)
+	w := serve(NewReplay(entries), req, failHandler(t))
+	st.Expect(t, w.Code, 202)
+	st.Expect(t, w.Body.Bytes(), []byte{0xff, 0x00})
+}
+
+func TestReplayRedactedBody(t *testing.T) {
+	capture := NewHARCapture(nil)
+	capture.Redact(RedactJSON("/password"))
+	replay := NewReplay(nil)
+	replay.RecordMissing(capture)
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("logged in"))
+	}
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("POST", "http://localhost/login", strings.NewReader(`{"password":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		st.Expect(t, serve(replay, req, handler).Body.String(), "logged in")
+	}
+	st.Expect(t, calls, 1)
+	st.Expect(t, replay.entries[0].Request.PostData.Text, `{"password":"REDACTED"}`)
+
+	req, _ := http.NewRequest("POST", "http://localhost/login", strings.NewReader(`{"password":"REDACTED"}`))
+	req.Header.Set("Content-Type", "application/json")
+	serve(replay, req, handler)
+	st.Expect(t, calls, 2)
+}
+
+func TestReplayMaxBodySize(t *testing.T) {
+	replay := NewReplay([]*HAREntry{replayEntry("POST", "http://example.com/", "large body", 200, "matched")})
+	replay.MaxBodySize = 4
+	replay.ErrorHandler = ErrorFallback
+
+	req, _ := http.NewRequest("POST", "http://localhost/", strings.NewReader("large body"))
+	w := serve(replay, req, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), "large body")
+		w.Write([]byte("upstream"))
+	})
+	st.Expect(t, w.Body.String(), "upstream")
+}
+
+func TestReplayBodyNotCaptured(t *testing.T) {
+	capture := NewHARCapture(nil)
+	capture.MaxBodySize = 4
+	replay := NewReplay(nil)
+	replay.RecordMissing(capture)
+
+	calls := 0
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("large body"))
+	}
+
+	// Responses whose body was not captured are requested again
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "http://localhost/large", nil)
+		w := serve(replay, req, handler)
+		st.Expect(t, w.Body.String(), "large body")
+	}
+	st.Expect(t, calls, 2)
+
+	// Requests whose body was not captured are not matched
+	entry := replayEntry("POST", "http://example.com/", "", 200, "matched")
+	entry.Request.Comment = harNotCaptured
+	replay = NewReplay([]*HAREntry{entry})
+	replay.ErrorHandler = ErrorFallback
+	req, _ := http.NewRequest("POST", "http://localhost/", nil)
+	w := serve(replay, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("upstream"))
+	})
+	st.Expect(t, w.Body.String(), "upstream")
+}
@@ -2,11 +2,14 @@ package intercept
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
@@ -18,6 +21,9 @@ type XMLCharDecoder func(charset string, input io.Reader) (io.Reader, error)
 // ReqModifierFunc represent the function interface for request modifiers.
 type ReqModifierFunc func(*RequestModifier)
 
+// ReqModifierFuncE represent the function interface for request modifiers that can fail.
+type ReqModifierFuncE func(*RequestModifier) error
+
 // Filter defines whether a RequestModifier should be applied or not.
 type Filter func(*http.Request) bool
 
@@ -30,78 +36,252 @@ type RequestModifier struct {
 
 	// Request exposes the current http.Request to be modified.
 	Request *http.Request
+
+	// aborted stores if the request should not reach the next handler.
+	aborted bool
+
+	// maxBodySize defines the maximum body size read in memory, if greater than zero.
+	maxBodySize int64
+
+	// body stores the body buffered for repeated reads.
+	body bodyBuffer
+
+	// overflowed stores if the body exceeded the maximum body size.
+	overflowed bool
+
+	// response stores the response to reply with, short-circuiting the request.
+	response *http.Response
 }
 
 // NewRequestModifier creates a new request modifier that modifies the given http.Request.
 func NewRequestModifier(req *http.Request) *RequestModifier {
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
 	return &RequestModifier{Request: req, Header: req.Header}
 }
 
+// Context returns the context of the intercepted request, which is canceled when the client goes away.
+func (s *RequestModifier) Context() context.Context {
+	return s.Request.Context()
+}
+
+// Param returns the value of the given path parameter, as matched by the Path or PathRegexp filters.
+func (s *RequestModifier) Param(name string) string {
+	return s.Request.PathValue(name)
+}
+
+// Respond short-circuits the current http.Request, replying to the client with the given
+// status code and body instead of calling the next handler. The returned ResponseModifier
+// can be used to further define the response headers and body.
+func (s *RequestModifier) Respond(status int, body string) *ResponseModifier {
+	s.response = &http.Response{
+		Request:    s.Request,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+	}
+	res := NewResponseModifier(s.Request, s.response)
+	res.Status(status)
+	res.String(body)
+	return res
+}
+
+// Redirect short-circuits the current http.Request, replying to the client
+// with a redirect to the given URL using the given status code.
+func (s *RequestModifier) Redirect(url string, code int) {
+	res := s.Respond(code, "")
+	res.Header.Set("Location", url)
+}
+
+// Abort short-circuits the current http.Request, preventing it from reaching the next handler.
+// No response is written by the interceptor.
+func (s *RequestModifier) Abort() {
+	s.aborted = true
+}
+
+// reply writes the short-circuit response, if any, in the given http.ResponseWriter.
+// It returns true if the request has been replied or aborted.
+func (s *RequestModifier) reply(w http.ResponseWriter) bool {
+	if s.response != nil {
+		writeResponse(w, s.response)
+	}
+	return s.response != nil || s.aborted
+}
+
 // ReadString reads the whole body of the current http.Request and returns it as string.
+// The body is transparently decoded based on the Content-Encoding header,
+// and converted into UTF-8 based on the Content-Type charset.
 func (s *RequestModifier) ReadString() (string, error) {
-	buf, err := ioutil.ReadAll(s.Request.Body)
+	buf, err := s.readText()
 	if err != nil {
 		return "", err
 	}
-	s.Bytes(buf)
 	return string(buf), nil
 }
 
+// readText reads the whole body of the current http.Request as UTF-8 text.
+func (s *RequestModifier) readText() ([]byte, error) {
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return decodeText(s.Request.Header, buf)
+}
+
+// setText sets the given UTF-8 text as http.Request body, encoded based on the Content-Type charset.
+func (s *RequestModifier) setText(text []byte) {
+	s.Bytes(encodeText(s.Request.Header, text))
+}
+
 // ReadBytes reads the whole body of the current http.Request and returns it as bytes.
+// The body is transparently decoded based on the Content-Encoding header.
+// If the raw or decoded body exceeds the interceptor maximum body size, a BodyTooLargeError is returned
+// and the body is left untouched.
+// The body is read once and shared by the modifiers of chained interceptors until replaced,
+// so the returned bytes must not be modified in place.
 func (s *RequestModifier) ReadBytes() ([]byte, error) {
-	buf, err := ioutil.ReadAll(s.Request.Body)
+	cache := s.cache()
+	if buf, ok := cache.get(&s.Request.Body, s.maxBodySize); ok {
+		return buf, nil
+	}
+
+	buf, body, err := readBody(s.Request.Body, s.maxBodySize)
+	s.Request.Body = body
 	if err != nil {
+		var tooLarge *BodyTooLargeError
+		s.overflowed = errors.As(err, &tooLarge)
 		return nil, err
 	}
-	s.Bytes(buf)
-	return buf, nil
+
+	decoded, err := decodeBody(s.Request.Header, buf, s.maxBodySize)
+	if err != nil {
+		var tooLarge *BodyTooLargeError
+		s.overflowed = errors.As(err, &tooLarge)
+		return nil, err
+	}
+	s.Request.Body = cache.set(buf, decoded)
+	return decoded, nil
 }
 
-// DecodeJSON reads and parses the current http.Request body and tries to decode it as JSON.
-func (s *RequestModifier) DecodeJSON(userStruct interface{}) error {
-	buf, err := s.ReadBytes()
+// cache returns the cache of the request body shared by the modifiers of the current request, if any.
+// Bodies buffered in temporary files are not cached.
+func (s *RequestModifier) cache() *cachedBody {
+	if cache := getBodyCache(s.Context()); cache != nil && s.body.threshold == 0 {
+		return &cache.request
+	}
+	return nil
+}
+
+// ReadSeeker buffers the whole body of the current http.Request and returns a seekable reader of it,
+// so it can be read repeatedly. The body is buffered in memory up to the interceptor spill threshold,
+// and in a temporary file above it, which is removed once the request is done.
+// The body is transparently decoded based on the Content-Encoding header.
+// Unless the SpillOverflow policy applies, a BodyTooLargeError is returned
+// if the raw or decoded body exceeds the interceptor maximum body size.
+func (s *RequestModifier) ReadSeeker() (io.ReadSeeker, error) {
+	reader, err := s.body.readSeeker(s.Context(), s.Request.Header, &s.Request.Body)
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) {
+		s.overflowed = true
+	}
+	return reader, err
+}
+
+// decoder returns a reader of the body as UTF-8 text, streamed from the spill buffer if enabled.
+func (s *RequestModifier) decoder() (io.Reader, error) {
+	if s.body.threshold > 0 {
+		reader, err := s.ReadSeeker()
+		if err != nil {
+			return nil, err
+		}
+		return decodeTextReader(s.Request.Header, reader), nil
+	}
+	buf, err := s.readText()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return bytes.NewReader(buf), nil
+}
 
-	jsonDecoder := json.NewDecoder(bytes.NewReader(buf))
-	err = jsonDecoder.Decode(&userStruct)
-	if err != nil && err != io.EOF {
+// DecodeJSON reads and parses the current http.Request body and tries to decode it as JSON.
+// The decoded value is shared by the modifiers of chained interceptors decoding the same body
+// into the same type, so it must not be modified unless set back as body.
+func (s *RequestModifier) DecodeJSON(userStruct interface{}) error {
+	reader, err := s.decoder()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.cache().decode("json", userStruct, func() error {
+		jsonDecoder := json.NewDecoder(reader)
+		err := jsonDecoder.Decode(&userStruct)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
 }
 
 // DecodeXML reads and parses the current http.Request body and tries to decode it as XML.
+// The decoded value is shared by the modifiers of chained interceptors decoding the same body
+// into the same type, so it must not be modified unless set back as body.
+// The given charset reader decodes XML declared in a non UTF-8 encoding when the Content-Type header
+// defines no charset. If nil, the registered charsets are used.
 func (s *RequestModifier) DecodeXML(userStruct interface{}, charsetReader XMLCharDecoder) error {
-	buf, err := s.ReadBytes()
+	reader, err := s.decoder()
 	if err != nil {
 		return err
 	}
 
-	xmlDecoder := xml.NewDecoder(bytes.NewReader(buf))
-	if charsetReader != nil {
-		xmlDecoder.CharsetReader = charsetReader
-	}
-	if err := xmlDecoder.Decode(&userStruct); err != nil && err != io.EOF {
-		return err
-	}
-
-	return nil
+	return s.cache().decode("xml", userStruct, func() error {
+		xmlDecoder := xml.NewDecoder(reader)
+		xmlDecoder.CharsetReader = xmlCharsetReader(s.Request.Header, charsetReader)
+		if err := xmlDecoder.Decode(&userStruct); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
 }
 
 // Bytes sets the given bytes as http.Request body.
+// The body is encoded based on the Content-Encoding header, if present.
 func (s *RequestModifier) Bytes(body []byte) {
-	s.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	buf, err := encodeBody(s.Request.Header, body)
+	if err != nil {
+		// Send the body unencoded if it cannot be encoded
+		s.Request.Header.Del("Content-Encoding")
+		buf = body
+	}
+
+	s.setBody(buf)
 }
 
-// String sets the given string as http.Request body.
+// setBody sets the given bytes as http.Request body, updating the content length fields
+// and removing any conflicting transfer encoding.
+func (s *RequestModifier) setBody(buf []byte) {
+	s.cache().invalidate()
+	req := s.Request
+	req.Body = http.NoBody
+	if len(buf) > 0 {
+		req.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	}
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(buf)), nil
+	}
+	req.ContentLength = int64(len(buf))
+	req.TransferEncoding = nil
+	req.Header.Set("Content-Length", strconv.Itoa(len(buf)))
+	req.Header.Del("Transfer-Encoding")
+}
+
+// String sets the given string as http.Request body, encoded based on the Content-Type charset.
 func (s *RequestModifier) String(body string) {
 	if s.Request.Method == "GET" || s.Request.Method == "HEAD" {
 		return
 	}
-	s.Request.Body = ioutil.NopCloser(bytes.NewReader([]byte(body)))
+	s.setText([]byte(body))
 }
 
 // JSON sets the given JSON serializable struct as http.Request body
@@ -120,9 +300,8 @@ func (s *RequestModifier) JSON(data interface{}) error {
 		}
 	}
 
-	s.Request.Body = ioutil.NopCloser(buf)
-	s.Request.ContentLength = int64(buf.Len())
-	s.Request.Header.Set("Content-Type", "application/json")
+	setContentType(s.Request.Header, "application/json")
+	s.setText(buf.Bytes())
 	return nil
 }
 
@@ -142,40 +321,109 @@ func (s *RequestModifier) XML(data interface{}) error {
 		}
 	}
 
-	s.Request.Body = ioutil.NopCloser(buf)
-	s.Request.ContentLength = int64(buf.Len())
-	s.Request.Header.Set("Content-Type", "application/xml")
+	setContentType(s.Request.Header, "application/xml")
+	s.setText(buf.Bytes())
 	return nil
 }
 
 // Reader sets the given io.Reader stream as http.Request body
-// defining the proper content length header.
+// defining the proper content length header, if known.
+// The stream is encoded on the fly based on the Content-Encoding header, if present.
 func (s *RequestModifier) Reader(body io.Reader) error {
+	s.cache().invalidate()
+	req := s.Request
+	req.GetBody = nil
+	req.TransferEncoding = nil
+	req.Header.Del("Transfer-Encoding")
+
+	if body == nil {
+		req.Body = nil
+		req.ContentLength = 0
+		req.Header.Del("Content-Length")
+		return nil
+	}
+
+	if encoded, ok := encodeReader(req.Header, body); ok {
+		req.Body = encoded
+		req.ContentLength = -1
+		req.Header.Del("Content-Length")
+		return nil
+	}
+
 	rc, ok := body.(io.ReadCloser)
-	if !ok && body != nil {
+	if !ok {
 		rc = ioutil.NopCloser(body)
 	}
 
-	req := s.Request
-	if body != nil {
-		switch v := body.(type) {
-		case *bytes.Buffer:
-			req.ContentLength = int64(v.Len())
-		case *bytes.Reader:
-			req.ContentLength = int64(v.Len())
-		case *strings.Reader:
-			req.ContentLength = int64(v.Len())
+	// Length of other streams is unknown until read
+	req.ContentLength = -1
+	switch v := body.(type) {
+	case *bytes.Buffer:
+		buf := v.Bytes()
+		req.ContentLength = int64(len(buf))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(buf)), nil
+		}
+	case *bytes.Reader:
+		snapshot := *v
+		req.ContentLength = int64(v.Len())
+		req.GetBody = func() (io.ReadCloser, error) {
+			r := snapshot
+			return ioutil.NopCloser(&r), nil
+		}
+	case *strings.Reader:
+		snapshot := *v
+		req.ContentLength = int64(v.Len())
+		req.GetBody = func() (io.ReadCloser, error) {
+			r := snapshot
+			return ioutil.NopCloser(&r), nil
 		}
 	}
 
 	req.Body = rc
+	if req.ContentLength >= 0 {
+		req.Header.Set("Content-Length", strconv.FormatInt(req.ContentLength, 10))
+	} else {
+		req.Header.Del("Content-Length")
+	}
+	return nil
+}
+
+// StripEncoding decodes the current http.Request body and removes the Content-Encoding header,
+// so the body and any further modification is sent unencoded.
+func (s *RequestModifier) StripEncoding() error {
+	if _, ok := contentCodecs(s.Request.Header); !ok {
+		return ErrUnsupportedEncoding
+	}
+
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return err
+	}
+
+	s.Request.Header.Del("Content-Encoding")
+	s.Bytes(buf)
 	return nil
 }
 
 // RequestInterceptor interceps a given http.Request using a custom request modifier function.
 type RequestInterceptor struct {
-	Modifier ReqModifierFunc
-	Filters  []Filter
+	Modifier     ReqModifierFunc
+	ModifierE    ReqModifierFuncE
+	ErrorHandler ErrorHandler
+	Filters      []Filter
+
+	// MaxBodySize defines the maximum request body size read in memory by the modifiers.
+	// Zero means no limit.
+	MaxBodySize int64
+
+	// Overflow defines the policy applied to request bodies larger than MaxBodySize.
+	Overflow OverflowPolicy
+
+	// SpillThreshold defines the size above which the bodies buffered by the modifiers
+	// are stored in a temporary file. Zero means MaxBodySize with SpillOverflow,
+	// and no temporary files otherwise.
+	SpillThreshold int64
 }
 
 // Request intercepts an HTTP request and passes it to the given request modifier function.
@@ -183,6 +431,12 @@ func Request(h ReqModifierFunc) *RequestInterceptor {
 	return &RequestInterceptor{Modifier: h, Filters: []Filter{}}
 }
 
+// RequestE intercepts an HTTP request and passes it to the given error-returning request modifier function.
+// Errors are handled by the interceptor ErrorHandler, or DefaultErrorHandler if not defined.
+func RequestE(h ReqModifierFuncE) *RequestInterceptor {
+	return &RequestInterceptor{ModifierE: h, Filters: []Filter{}}
+}
+
 // Filter intercepts an HTTP requests if and only if the given filter returns true.
 func (s *RequestInterceptor) Filter(f ...Filter) {
 	s.Filters = append(s.Filters, f...)
@@ -192,12 +446,114 @@ func (s *RequestInterceptor) Filter(f ...Filter) {
 // This methods implements the middleware layer compatible interface.
 func (s *RequestInterceptor) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
 	if s.filter(r) {
-		req := NewRequestModifier(r)
-		s.Modifier(req)
+		r = withBodyCache(r)
+		if s.MaxBodySize > 0 && r.ContentLength > s.MaxBodySize {
+			if s.Overflow == RejectOverflow && s.reject(w, r, &BodyTooLargeError{Limit: s.MaxBodySize}) {
+				return
+			}
+			if s.Overflow != SpillOverflow {
+				h.ServeHTTP(w, r)
+				return
+			}
+		}
+		if s.Modifier != nil {
+			req := s.newModifier(r)
+			defer req.body.close()
+			s.Modifier(req)
+			if req.overflowed && s.Overflow == RejectOverflow && s.reject(w, r, &BodyTooLargeError{Limit: s.MaxBodySize}) {
+				return
+			}
+			if req.reply(w) {
+				return
+			}
+		}
+		if s.ModifierE != nil {
+			var req *RequestModifier
+			r, req = s.modify(w, r)
+			defer req.body.close()
+			if r == nil {
+				return
+			}
+		}
 	}
 	h.ServeHTTP(w, r)
 }
 
+// newModifier creates a request modifier configured with the interceptor body limits.
+func (s *RequestInterceptor) newModifier(r *http.Request) *RequestModifier {
+	req := NewRequestModifier(r)
+	req.maxBodySize = s.MaxBodySize
+	req.body.threshold = s.spillThreshold()
+	if s.Overflow != SpillOverflow {
+		req.body.limit = s.MaxBodySize
+	}
+	return req
+}
+
+// spillThreshold returns the size above which the buffered bodies are stored in a temporary file.
+func (s *RequestInterceptor) spillThreshold() int64 {
+	if s.SpillThreshold == 0 && s.Overflow == SpillOverflow {
+		return s.MaxBodySize
+	}
+	return s.SpillThreshold
+}
+
+// modify calls the error-returning modifier function over a copy of the given request.
+// It returns the request to be served, or nil if the request has been replied to the client,
+// and the modifier used.
+func (s *RequestInterceptor) modify(w http.ResponseWriter, r *http.Request) (*http.Request, *RequestModifier) {
+	// Record the consumed body so the original request can be restored
+	consumed := newSpillBuffer(r.Context(), s.spillThreshold())
+	recorder := &switchWriter{consumed}
+	req := r.Clone(r.Context())
+	modifier := s.newModifier(req)
+
+	// Bodies already read by a previous modifier are restored from the cache
+	cached, isCached := modifier.cache().source(r.Body)
+	var body io.ReadCloser
+	if r.Body != nil && !isCached {
+		body = &readCloser{io.TeeReader(r.Body, recorder), r.Body}
+		req.Body = body
+	}
+
+	err := s.ModifierE(modifier)
+	if err == nil && modifier.overflowed && s.Overflow == RejectOverflow {
+		err = &BodyTooLargeError{Limit: s.MaxBodySize}
+	}
+	if err == nil {
+		if modifier.reply(w) {
+			return nil, modifier
+		}
+		if body != nil && req.Body == body {
+			// Stop recording if the body has not been replaced
+			req.Body = restoreBody(consumed, r.Body)
+		} else {
+			// Discard the recorded body if it has been replaced
+			recorder.Writer = ioutil.Discard
+			consumed.Close()
+		}
+		return req, modifier
+	}
+	var tooLarge *BodyTooLargeError
+	if errors.As(err, &tooLarge) && s.Overflow != SpillOverflow {
+		if s.Overflow == RejectOverflow && s.reject(w, r, tooLarge) {
+			return nil, modifier
+		}
+	} else if handleError(s.ErrorHandler, w, r, err) {
+		return nil, modifier
+	}
+
+	// Fall back to the unmodified request
+	if isCached {
+		if _, ok := modifier.cache().get(&r.Body, 0); !ok {
+			r.Body = ioutil.NopCloser(bytes.NewReader(cached))
+		}
+	} else if r.Body != nil {
+		r.Body = restoreBody(consumed, r.Body)
+	}
+	return r, modifier
+}
+
 func (s RequestInterceptor) filter(req *http.Request) bool {
 	for _, filter := range s.Filters {
 		if !filter(req) {
@@ -206,3 +562,42 @@ func (s RequestInterceptor) filter(req *http.Request) bool {
 	}
 	return true
 }
+
+// reject handles a request whose body exceeds the maximum body size,
+// replying with a 413 Request Entity Too Large error if no error handler is defined.
+func (s *RequestInterceptor) reject(w http.ResponseWriter, r *http.Request, err error) bool {
+	handler := s.ErrorHandler
+	if handler == nil {
+		handler = ErrorStatus(http.StatusRequestEntityTooLarge)
+	}
+	return handler(w, r, err)
+}
+
+// readCloser joins an io.Reader and an io.Closer.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// restoreBody returns a body that reads the already consumed bytes followed by the rest of the given body.
+func restoreBody(consumed *spillBuffer, body io.ReadCloser) io.ReadCloser {
+	if consumed.Len() == 0 {
+		return body
+	}
+	return &readCloser{io.MultiReader(consumed.Reader(), body), closerFunc(func() error {
+		consumed.Close()
+		return body.Close()
+	})}
+}
+
+// switchWriter is an io.Writer whose destination can be replaced.
+type switchWriter struct {
+	io.Writer
+}
+
+// closerFunc implements io.Closer using a function.
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
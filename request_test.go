@@ -6,10 +6,10 @@ import (
 	"encoding/xml"
 	"errors"
 	"github.com/nbio/st"
-	"gopkg.in/vinxi/utils.v0"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -247,11 +247,11 @@ func TestJSONWithBytesAsParameter(t *testing.T) {
 func TestJSONEncodingError(t *testing.T) {
 	req := &http.Request{Header: http.Header{}}
 	modifier := NewRequestModifier(req)
-	input := make(map[int]int)
+	input := make(chan int)
 	err := modifier.JSON(input)
 	_, ok := err.(*json.UnsupportedTypeError)
 	st.Expect(t, ok, true)
-	st.Expect(t, err.Error(), "json: unsupported type: map[int]int")
+	st.Expect(t, err.Error(), "json: unsupported type: chan int")
 }
 
 func TestXMLWithStructAsParameter(t *testing.T) {
@@ -355,7 +355,7 @@ func TestHandleHTTP(t *testing.T) {
 		m.Header.Set("foo", "bar")
 		m.String("Hello")
 	})
-	stubbedWriter := utils.NewWriterStub()
+	stubbedWriter := httptest.NewRecorder()
 	req := &http.Request{Method: "POST", Header: make(http.Header)}
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
 		st.Expect(t, writer, stubbedWriter)
@@ -368,7 +368,7 @@ func TestHandleHTTP(t *testing.T) {
 
 func TestFilterWithRequestFilteredOut(t *testing.T) {
 	interceptor := interceptorWithFilters()
-	stubbedWriter := utils.NewWriterStub()
+	stubbedWriter := httptest.NewRecorder()
 	req := &http.Request{Method: "POST"}
 	handler := http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
 		st.Expect(t, r.Header.Get("intercepted"), "")
@@ -378,7 +378,7 @@ func TestFilterWithRequestFilteredOut(t *testing.T) {
 
 func TestFilterWithRequestFilteredIn(t *testing.T) {
 	interceptor := interceptorWithFilters()
-	stubbedWriter := utils.NewWriterStub()
+	stubbedWriter := httptest.NewRecorder()
 	req := &http.Request{Method: "POST", Header: http.Header{}}
 	req.Header.Set("filter2", "true")
 	req.Header.Set("filter3", "true")
@@ -404,3 +404,147 @@ func interceptorWithFilters() *RequestInterceptor {
 	})
 	return interceptor
 }
+
+func TestRequestEWithError(t *testing.T) {
+	interceptor := RequestE(func(m *RequestModifier) error {
+		m.Header.Set("foo", "bar")
+		return errModifier
+	})
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("Hello"))
+	recorder := httptest.NewRecorder()
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+	interceptor.HandleHTTP(recorder, req, handler)
+	st.Expect(t, called, false)
+	st.Expect(t, recorder.Code, 500)
+}
+
+func TestRequestEWithErrorFallback(t *testing.T) {
+	interceptor := RequestE(func(m *RequestModifier) error {
+		m.Header.Set("foo", "bar")
+		var u user
+		return m.DecodeJSON(&u)
+	})
+	interceptor.ErrorHandler = ErrorFallback
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("<xml>"))
+	called := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		st.Expect(t, r.Header.Get("foo"), "")
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), "<xml>")
+	})
+	interceptor.HandleHTTP(httptest.NewRecorder(), req, handler)
+	st.Expect(t, called, true)
+}
+
+func TestRequestEWithoutError(t *testing.T) {
+	interceptor := RequestE(func(m *RequestModifier) error {
+		m.Header.Set("foo", "bar")
+		return nil
+	})
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("Hello"))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, r.Header.Get("foo"), "bar")
+		body, _ := ioutil.ReadAll(r.Body)
+		st.Expect(t, string(body), "Hello")
+	})
+	interceptor.HandleHTTP(httptest.NewRecorder(), req, handler)
+}
+
+func TestRespond(t *testing.T) {
+	interceptor := Request(func(m *RequestModifier) {
+		m.Respond(503, "maintenance").Header.Set("Retry-After", "120")
+	})
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Code, 503)
+	st.Expect(t, recorder.Body.String(), "maintenance")
+	st.Expect(t, recorder.Header().Get("Retry-After"), "120")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "11")
+}
+
+func TestRespondJSON(t *testing.T) {
+	interceptor := RequestE(func(m *RequestModifier) error {
+		return m.Respond(200, "").JSON(map[string]string{"mock": "true"})
+	})
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Code, 200)
+	st.Expect(t, recorder.Body.String(), "{\"mock\":\"true\"}\n")
+	st.Expect(t, recorder.Header().Get("Content-Type"), "application/json")
+}
+
+func TestRedirect(t *testing.T) {
+	interceptor := Request(func(m *RequestModifier) {
+		m.Redirect("/login", 302)
+	})
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Code, 302)
+	st.Expect(t, recorder.Header().Get("Location"), "/login")
+}
+
+func TestAbort(t *testing.T) {
+	interceptor := Request(func(m *RequestModifier) {
+		m.Abort()
+	})
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("next handler must not be called")
+	})
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Body.Len(), 0)
+}
+
+func TestBytesUpdatesContentLength(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("Hello"))
+	req.Header.Set("Content-Length", "5")
+	req.Header.Set("Transfer-Encoding", "chunked")
+	req.TransferEncoding = []string{"chunked"}
+	modifier := NewRequestModifier(req)
+	modifier.String("Hello world")
+	st.Expect(t, req.ContentLength, int64(11))
+	st.Expect(t, req.Header.Get("Content-Length"), "11")
+	st.Expect(t, req.Header.Get("Transfer-Encoding"), "")
+	st.Expect(t, len(req.TransferEncoding), 0)
+
+	body, err := req.GetBody()
+	st.Expect(t, err, nil)
+	buf, _ := ioutil.ReadAll(body)
+	st.Expect(t, string(buf), "Hello world")
+
+	modifier.Bytes([]byte{})
+	st.Expect(t, req.Body, http.NoBody)
+	st.Expect(t, req.Header.Get("Content-Length"), "0")
+}
+
+func TestReaderUpdatesContentLength(t *testing.T) {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader("Hello"))
+	req.Header.Set("Content-Length", "5")
+	modifier := NewRequestModifier(req)
+
+	modifier.Reader(bytes.NewReader([]byte("Hello world")))
+	st.Expect(t, req.ContentLength, int64(11))
+	st.Expect(t, req.Header.Get("Content-Length"), "11")
+	ioutil.ReadAll(req.Body)
+	body, _ := req.GetBody()
+	buf, _ := ioutil.ReadAll(body)
+	st.Expect(t, string(buf), "Hello world")
+
+	modifier.Reader(ioutil.NopCloser(strings.NewReader("stream")))
+	st.Expect(t, req.ContentLength, int64(-1))
+	st.Expect(t, req.Header.Get("Content-Length"), "")
+	st.Expect(t, req.GetBody == nil, true)
+}
@@ -2,6 +2,7 @@ package intercept
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"io"
@@ -15,6 +16,14 @@ import (
 // ResModifierFunc defines the function interface for http.Response modifiers.
 type ResModifierFunc func(*ResponseModifier)
 
+// ResModifierFuncE defines the function interface for http.Response modifiers that can fail.
+type ResModifierFuncE func(*ResponseModifier) error
+
+// ResFilter defines whether a ResponseModifier should be applied or not.
+// Response filters are evaluated once the response status and headers are known,
+// before the response body is buffered.
+type ResFilter func(*http.Response) bool
+
 // ResponseModifier implements a convenient abstraction to modify an http.Response,
 // including methods to read, decode/encode and define JSON/XML/String/Binary bodies
 // and modify HTTP headers.
@@ -22,13 +31,34 @@ type ResponseModifier struct {
 	Header   http.Header
 	Request  *http.Request
 	Response *http.Response
+
+	// maxBodySize defines the maximum body size read in memory, if greater than zero.
+	maxBodySize int64
+
+	// body stores the body buffered for repeated reads.
+	body bodyBuffer
+
+	// lazy defers the body buffering until a body method is called, if defined.
+	lazy *lazyModifier
 }
 
 // NewResponseModifier creates a new response modifier that modifies the given http.Response.
 func NewResponseModifier(req *http.Request, res *http.Response) *ResponseModifier {
+	if res.Header == nil {
+		res.Header = make(http.Header)
+	}
 	return &ResponseModifier{Request: req, Response: res, Header: res.Header}
 }
 
+// Context returns the context of the intercepted request, which is canceled when the client goes away.
+// Long-running modifiers should use it to abort their work.
+func (s *ResponseModifier) Context() context.Context {
+	if s.Request == nil {
+		return context.Background()
+	}
+	return s.Request.Context()
+}
+
 // Status sets a new status code in the http.Response to be modified.
 func (s *ResponseModifier) Status(status int) {
 	s.Response.StatusCode = status
@@ -36,67 +66,175 @@ func (s *ResponseModifier) Status(status int) {
 }
 
 // ReadString reads the whole body of the current http.Response and returns it as string.
+// The body is transparently decoded based on the Content-Encoding header,
+// and converted into UTF-8 based on the Content-Type charset.
 func (s *ResponseModifier) ReadString() (string, error) {
-	buf, err := ioutil.ReadAll(s.Response.Body)
+	buf, err := s.readText()
 	if err != nil {
 		return "", err
 	}
-	s.Bytes(buf)
 	return string(buf), nil
 }
 
+// readText reads the whole body of the current http.Response as UTF-8 text.
+func (s *ResponseModifier) readText() ([]byte, error) {
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return nil, err
+	}
+	return decodeText(s.Response.Header, buf)
+}
+
+// setText sets the given UTF-8 text as http.Response body, encoded based on the Content-Type charset.
+func (s *ResponseModifier) setText(text []byte) {
+	s.Bytes(encodeText(s.Response.Header, text))
+}
+
 // ReadBytes reads the whole body of the current http.Response and returns it as bytes.
+// The body is transparently decoded based on the Content-Encoding header.
+// If the raw or decoded body exceeds the interceptor maximum body size, a BodyTooLargeError is returned
+// and the body is left untouched.
+// The body is read once and shared by the modifiers of chained interceptors until replaced,
+// so the returned bytes must not be modified in place.
 func (s *ResponseModifier) ReadBytes() ([]byte, error) {
-	buf, err := ioutil.ReadAll(s.Response.Body)
+	if err := s.loadBody(); err != nil {
+		return nil, err
+	}
+
+	cache := s.cache()
+	if buf, ok := cache.get(&s.Response.Body, s.maxBodySize); ok {
+		return buf, nil
+	}
+
+	buf, body, err := readBody(s.Response.Body, s.maxBodySize)
+	s.Response.Body = body
 	if err != nil {
 		return nil, err
 	}
-	s.Bytes(buf)
-	return buf, nil
-}
 
-// DecodeJSON reads and parses the current http.Response body and tries to decode it as JSON.
-func (s *ResponseModifier) DecodeJSON(userStruct interface{}) error {
-	buf, err := s.ReadBytes()
+	decoded, err := decodeBody(s.Response.Header, buf, s.maxBodySize)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	s.Response.Body = cache.set(buf, decoded)
+	return decoded, nil
+}
 
-	jsonDecoder := json.NewDecoder(bytes.NewReader(buf))
-	err = jsonDecoder.Decode(&userStruct)
-	if err != nil && err != io.EOF {
-		return err
+// loadBody waits until the response body is buffered, if deferred by the interceptor.
+func (s *ResponseModifier) loadBody() error {
+	if s.lazy == nil {
+		return nil
 	}
+	return s.lazy.load()
+}
 
+// cache returns the cache of the response body shared by the modifiers of the current request, if any.
+// Bodies buffered in temporary files are not cached.
+func (s *ResponseModifier) cache() *cachedBody {
+	if cache := getBodyCache(s.Context()); cache != nil && s.body.threshold == 0 {
+		return &cache.response
+	}
 	return nil
 }
 
-// DecodeXML reads and parses the current http.Response body and tries to decode it as XML.
-func (s *ResponseModifier) DecodeXML(userStruct interface{}, charsetReader XMLCharDecoder) error {
-	buf, err := s.ReadBytes()
+// ReadSeeker buffers the whole body of the current http.Response and returns a seekable reader of it,
+// so it can be read repeatedly. The body is buffered in memory up to the interceptor spill threshold,
+// and in a temporary file above it, which is removed once the request is done.
+// The body is transparently decoded based on the Content-Encoding header.
+// Unless the SpillOverflow policy applies, a BodyTooLargeError is returned
+// if the decoded body exceeds the interceptor maximum body size.
+func (s *ResponseModifier) ReadSeeker() (io.ReadSeeker, error) {
+	if err := s.loadBody(); err != nil {
+		return nil, err
+	}
+	return s.body.readSeeker(s.Context(), s.Response.Header, &s.Response.Body)
+}
+
+// decoder returns a reader of the body as UTF-8 text, streamed from the spill buffer if enabled.
+func (s *ResponseModifier) decoder() (io.Reader, error) {
+	if s.body.threshold > 0 {
+		reader, err := s.ReadSeeker()
+		if err != nil {
+			return nil, err
+		}
+		return decodeTextReader(s.Response.Header, reader), nil
+	}
+	buf, err := s.readText()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return bytes.NewReader(buf), nil
+}
 
-	xmlDecoder := xml.NewDecoder(bytes.NewReader(buf))
-	if charsetReader != nil {
-		xmlDecoder.CharsetReader = charsetReader
+// DecodeJSON reads and parses the current http.Response body and tries to decode it as JSON.
+// The decoded value is shared by the modifiers of chained interceptors decoding the same body
+// into the same type, so it must not be modified unless set back as body.
+func (s *ResponseModifier) DecodeJSON(userStruct interface{}) error {
+	reader, err := s.decoder()
+	if err != nil {
+		return err
 	}
-	if err := xmlDecoder.Decode(&userStruct); err != nil && err != io.EOF {
+
+	return s.cache().decode("json", userStruct, func() error {
+		jsonDecoder := json.NewDecoder(reader)
+		err := jsonDecoder.Decode(&userStruct)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
+}
+
+// DecodeXML reads and parses the current http.Response body and tries to decode it as XML.
+// The decoded value is shared by the modifiers of chained interceptors decoding the same body
+// into the same type, so it must not be modified unless set back as body.
+// The given charset reader decodes XML declared in a non UTF-8 encoding when the Content-Type header
+// defines no charset. If nil, the registered charsets are used.
+func (s *ResponseModifier) DecodeXML(userStruct interface{}, charsetReader XMLCharDecoder) error {
+	reader, err := s.decoder()
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return s.cache().decode("xml", userStruct, func() error {
+		xmlDecoder := xml.NewDecoder(reader)
+		xmlDecoder.CharsetReader = xmlCharsetReader(s.Response.Header, charsetReader)
+		if err := xmlDecoder.Decode(&userStruct); err != nil && err != io.EOF {
+			return err
+		}
+		return nil
+	})
 }
 
-// String sets the given string as http.Response body.
+// String sets the given string as http.Response body, encoded based on the Content-Type charset.
 func (s *ResponseModifier) String(body string) {
-	s.Response.Body = ioutil.NopCloser(bytes.NewReader([]byte(body)))
+	s.setText([]byte(body))
 }
 
 // Bytes sets the given bytes as http.Response body.
+// The body is encoded based on the Content-Encoding header, if present.
 func (s *ResponseModifier) Bytes(body []byte) {
-	s.Response.Body = ioutil.NopCloser(bytes.NewReader(body))
+	buf, err := encodeBody(s.Response.Header, body)
+	if err != nil {
+		// Send the body unencoded if it cannot be encoded
+		s.Response.Header.Del("Content-Encoding")
+		buf = body
+	}
+
+	s.setBody(buf)
+}
+
+// setBody sets the given bytes as http.Response body, updating the content length fields
+// and removing any conflicting transfer encoding.
+func (s *ResponseModifier) setBody(buf []byte) {
+	s.loadBody()
+	s.cache().invalidate()
+	resp := s.Response
+	resp.Body = ioutil.NopCloser(bytes.NewReader(buf))
+	resp.ContentLength = int64(len(buf))
+	resp.TransferEncoding = nil
+	resp.Header.Set("Content-Length", strconv.Itoa(len(buf)))
+	resp.Header.Del("Transfer-Encoding")
 }
 
 // JSON sets the given JSON serializable struct as http.Response body
@@ -115,9 +253,8 @@ func (s *ResponseModifier) JSON(data interface{}) error {
 		}
 	}
 
-	s.Response.Body = ioutil.NopCloser(buf)
-	s.Response.ContentLength = int64(buf.Len())
-	s.Response.Header.Set("Content-Type", "application/json")
+	setContentType(s.Response.Header, "application/json")
+	s.setText(buf.Bytes())
 	return nil
 }
 
@@ -137,52 +274,136 @@ func (s *ResponseModifier) XML(data interface{}) error {
 		}
 	}
 
-	s.Response.Body = ioutil.NopCloser(buf)
-	s.Response.ContentLength = int64(buf.Len())
-	s.Response.Header.Set("Content-Type", "application/xml")
+	setContentType(s.Response.Header, "application/xml")
+	s.setText(buf.Bytes())
 	return nil
 }
 
 // Reader sets the given io.Reader stream as http.Response body
-// defining the proper content length header.
+// defining the proper content length header, if known.
+// The stream is encoded on the fly based on the Content-Encoding header, if present.
 func (s *ResponseModifier) Reader(body io.Reader) error {
+	s.loadBody()
+	s.cache().invalidate()
+	resp := s.Response
+	resp.TransferEncoding = nil
+	resp.Header.Del("Transfer-Encoding")
+
+	if body == nil {
+		resp.Body = nil
+		resp.ContentLength = 0
+		resp.Header.Del("Content-Length")
+		return nil
+	}
+
+	if encoded, ok := encodeReader(resp.Header, body); ok {
+		resp.Body = encoded
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+		return nil
+	}
+
 	rc, ok := body.(io.ReadCloser)
-	if !ok && body != nil {
+	if !ok {
 		rc = ioutil.NopCloser(body)
 	}
 
-	resp := s.Response
-	if body != nil {
-		switch v := body.(type) {
-		case *bytes.Buffer:
-			resp.ContentLength = int64(v.Len())
-		case *bytes.Reader:
-			resp.ContentLength = int64(v.Len())
-		case *strings.Reader:
-			resp.ContentLength = int64(v.Len())
-		}
+	// Length of other streams is unknown until read
+	resp.ContentLength = -1
+	switch v := body.(type) {
+	case *bytes.Buffer:
+		resp.ContentLength = int64(v.Len())
+	case *bytes.Reader:
+		resp.ContentLength = int64(v.Len())
+	case *strings.Reader:
+		resp.ContentLength = int64(v.Len())
 	}
 
 	resp.Body = rc
+	if resp.ContentLength >= 0 {
+		resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	} else {
+		resp.Header.Del("Content-Length")
+	}
+	return nil
+}
+
+// StripEncoding decodes the current http.Response body and removes the Content-Encoding header,
+// so the body and any further modification is sent unencoded.
+func (s *ResponseModifier) StripEncoding() error {
+	if _, ok := contentCodecs(s.Response.Header); !ok {
+		return ErrUnsupportedEncoding
+	}
+
+	buf, err := s.ReadBytes()
+	if err != nil {
+		return err
+	}
+
+	s.Response.Header.Del("Content-Encoding")
+	s.Bytes(buf)
 	return nil
 }
 
+// writeResponse writes the given http.Response status, headers and body in the http.ResponseWriter.
+func writeResponse(w http.ResponseWriter, res *http.Response) error {
+	target := w.Header()
+	for k, v := range res.Header {
+		target[k] = v
+	}
+	if res.ContentLength >= 0 {
+		target.Set("Content-Length", strconv.FormatInt(res.ContentLength, 10))
+	} else {
+		target.Del("Content-Length")
+	}
+	w.WriteHeader(res.StatusCode)
+
+	if res.Body == nil {
+		return nil
+	}
+	defer res.Body.Close()
+	_, err := io.Copy(w, res.Body)
+	return err
+}
+
 // WriterInterceptor implements an http.ResponseWriter compatible interface that will intercept and buffer
-// any method call until the body writes is completed, and then will call the http.Response modifier
-// function to intercept and modify it accordingly before writting the final response fields.
+// any method call until the intercepted handler is done writing the response, and then will call the
+// http.Response modifier function to intercept and modify it accordingly before writting the final response fields.
 type WriterInterceptor struct {
 	closed        bool
+	filtered      bool
+	bypass        bool
 	headerWritten bool
 	buf           []byte
+	spill         *spillBuffer
+	threshold     int64
+	body          *bodyBuffer
+	maxBodySize   int64
+	overflow      OverflowPolicy
+	overflowed    bool
+	tooLarge      error
+	lazyEnabled   bool
+	lazy          *lazyModifier
 	mutex         *sync.Mutex
+	filters       []ResFilter
 	response      *http.Response
-	modifier      ResModifierFunc
+	modifier      ResModifierFuncE
+	errorHandler  ErrorHandler
 	writer        http.ResponseWriter
 }
 
 // NewWriterInterceptor creates a new http.ResponseWriter capable interface
 // that will intercept the current response.
 func NewWriterInterceptor(w http.ResponseWriter, req *http.Request, fn ResModifierFunc) *WriterInterceptor {
+	return NewWriterInterceptorE(w, req, func(m *ResponseModifier) error {
+		fn(m)
+		return nil
+	})
+}
+
+// NewWriterInterceptorE creates a new http.ResponseWriter capable interface
+// that will intercept the current response using an error-returning modifier function.
+func NewWriterInterceptorE(w http.ResponseWriter, req *http.Request, fn ResModifierFuncE) *WriterInterceptor {
 	res := &http.Response{
 		Request:    req,
 		StatusCode: 200,
@@ -201,106 +422,469 @@ func (w *WriterInterceptor) Header() http.Header {
 	return w.response.Header
 }
 
+// OnError defines the handler for errors returned by the modifier function.
+// If not defined, DefaultErrorHandler is used.
+func (w *WriterInterceptor) OnError(handler ErrorHandler) {
+	w.errorHandler = handler
+}
+
+// Filter intercepts the response if and only if the given response filters returns true.
+// Otherwise the response is written to the client untouched, without being buffered.
+func (w *WriterInterceptor) Filter(f ...ResFilter) {
+	w.filters = append(w.filters, f...)
+}
+
+// Limit defines the maximum response body size buffered in memory,
+// and the policy applied to larger bodies. Zero size means no limit.
+func (w *WriterInterceptor) Limit(size int64, policy OverflowPolicy) {
+	w.maxBodySize = size
+	w.overflow = policy
+}
+
+// Spill defines the size above which the response body is buffered in a temporary file
+// instead of memory, including the bodies buffered by the modifier. Zero means no temporary files,
+// unless the SpillOverflow policy applies.
+func (w *WriterInterceptor) Spill(threshold int64) {
+	w.threshold = threshold
+}
+
+// Lazy enables the lazy buffering mode: the modifier function is called as soon as the response
+// header is known, and the response body is buffered only if the modifier calls a body method,
+// which blocks until the intercepted handler is done. Otherwise the response body is streamed
+// straight through to the client.
+func (w *WriterInterceptor) Lazy(enabled bool) {
+	w.lazyEnabled = enabled
+}
+
 // WriteHeader intercepts the desired response status code.
 func (w *WriterInterceptor) WriteHeader(status int) {
+	if w.bypass {
+		return
+	}
 	w.response.StatusCode = status
 	w.response.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	w.filter()
 }
 
 // Write intercepts and stores chunks of bytes as part of the response body.
+// The body is buffered regardless of the Content-Length or Transfer-Encoding
+// defined by the intercepted handler until Done is called.
 func (w *WriterInterceptor) Write(b []byte) (int, error) {
-	length := w.response.Header.Get("Content-Length")
-	if length == "" || length == "0" {
-		w.buf = b
-		return w.DoWrite()
+	w.filter()
+	if w.bypass {
+		return w.writer.Write(b)
+	}
+	if w.closed {
+		return 0, nil
+	}
+	if err := w.context().Err(); err != nil {
+		w.Close()
+		return 0, err
+	}
+	if w.tooLarge != nil {
+		return 0, w.tooLarge
+	}
+	if w.maxBodySize > 0 && !w.overflowed && w.bufferedLen()+int64(len(b)) > w.maxBodySize {
+		w.overflowBody()
+		return w.Write(b)
+	}
+	if w.spill == nil && w.threshold > 0 {
+		w.spill = newSpillBuffer(w.context(), w.threshold)
+	}
+	if w.spill != nil {
+		return w.spill.Write(b)
 	}
-
-	w.response.ContentLength += int64(len(b))
 	w.buf = append(w.buf, b...)
+	return len(b), nil
+}
 
-	// If not EOF
-	if cl, _ := strconv.Atoi(length); w.response.ContentLength != int64(cl) {
-		return len(b), nil
+// bufferedLen returns the length of the buffered response body.
+func (w *WriterInterceptor) bufferedLen() int64 {
+	if w.spill != nil {
+		return w.spill.Len()
 	}
+	return int64(len(w.buf))
+}
 
-	w.response.Body = ioutil.NopCloser(bytes.NewReader(w.buf))
+// overflowBody applies the overflow policy once the response body exceeds the maximum size.
+func (w *WriterInterceptor) overflowBody() {
+	w.overflowed = true
+	switch w.overflow {
+	case PassthroughOverflow:
+		w.passthrough()
+		w.writeBuffered()
+	case SpillOverflow:
+		if w.spill == nil {
+			threshold := w.threshold
+			if threshold == 0 {
+				threshold = w.maxBodySize
+			}
+			w.spill = newSpillBuffer(w.context(), threshold)
+			w.spill.Write(w.buf)
+		}
+	default:
+		w.tooLarge = &BodyTooLargeError{Limit: w.maxBodySize}
+		if w.spill != nil {
+			w.spill.Close()
+			w.spill = nil
+		}
+	}
+	w.buf = nil
+}
+
+// writeBuffered writes the buffered response body untouched in the real http.ResponseWriter.
+func (w *WriterInterceptor) writeBuffered() {
+	if len(w.buf) > 0 {
+		w.writer.Write(w.buf)
+	}
+	if w.spill != nil {
+		io.Copy(w.writer, w.spill.Reader())
+		w.spill.Close()
+		w.spill = nil
+	}
+	w.buf = nil
+}
+
+// context returns the context of the intercepted request.
+func (w *WriterInterceptor) context() context.Context {
+	if w.response.Request == nil {
+		return context.Background()
+	}
+	return w.response.Request.Context()
+}
+
+// filter evaluates the response filters once the response header is known,
+// switching the interceptor to pass-through mode if any filter does not match.
+func (w *WriterInterceptor) filter() {
+	if w.filtered {
+		return
+	}
+	w.filtered = true
+
+	w.response.ContentLength = -1
+	if length, err := strconv.ParseInt(w.response.Header.Get("Content-Length"), 10, 64); err == nil {
+		w.response.ContentLength = length
+	}
+
+	for _, filter := range w.filters {
+		if !filter(w.response) {
+			w.passthrough()
+			return
+		}
+	}
+
+	if w.maxBodySize > 0 && w.response.ContentLength > w.maxBodySize {
+		w.overflowBody()
+	}
+	if w.lazyEnabled && !w.bypass && w.tooLarge == nil {
+		w.startLazy()
+	}
+}
+
+// startLazy calls the modifier function in lazy buffering mode,
+// switching to pass-through mode if it returns without calling a body method.
+func (w *WriterInterceptor) startLazy() {
+	lazy, requested := startLazyModifier(w.newModifier(), w.modifier)
+	if requested {
+		w.lazy = lazy
+		return
+	}
+
+	if lazy.err != nil {
+		if handleError(w.errorHandler, w.writer, w.response.Request, lazy.err) {
+			w.headerWritten = true
+			w.Close()
+			return
+		}
+
+		// Fall back to the unmodified response header
+		lazy.restore(w.response)
+	}
+	w.passthrough()
+}
+
+// newModifier creates the response modifier configured with the interceptor body limits.
+func (w *WriterInterceptor) newModifier() *ResponseModifier {
 	resm := NewResponseModifier(w.response.Request, w.response)
-	w.modifier(resm)
+	resm.maxBodySize = w.maxBodySize
+	resm.body.threshold = w.threshold
+	if resm.body.threshold == 0 && w.overflow == SpillOverflow {
+		resm.body.threshold = w.maxBodySize
+	}
+	if w.overflow != SpillOverflow {
+		resm.body.limit = w.maxBodySize
+	}
+	w.body = &resm.body
+	return resm
+}
+
+// passthrough writes the response header untouched and flags the interceptor
+// to write any further body chunk directly in the real http.ResponseWriter.
+func (w *WriterInterceptor) passthrough() {
+	w.bypass = true
+	w.headerWritten = true
+
+	target := w.writer.Header()
+	for k, v := range w.response.Header {
+		target[k] = v
+	}
+	w.writer.WriteHeader(w.response.StatusCode)
+}
+
+// Done notifies the interceptor that the intercepted handler finished writing the response.
+// The http.Response modifier function is then called once with the complete response body,
+// and the final response is written in the real http.ResponseWriter.
+// If the client went away, the buffered body is discarded and the context error is returned.
+func (w *WriterInterceptor) Done() (int, error) {
+	w.filter()
+	if w.bypass || w.closed {
+		return 0, nil
+	}
+	if err := w.context().Err(); err != nil {
+		w.Close()
+		return 0, err
+	}
+
+	if w.tooLarge != nil {
+		handler := w.errorHandler
+		if handler == nil {
+			handler = ErrorStatus(http.StatusBadGateway)
+		}
+		handler(w.writer, w.response.Request, w.tooLarge)
+		w.headerWritten = true
+		w.Close()
+		return 0, w.tooLarge
+	}
+
+	var resm *ResponseModifier
+	if w.lazy != nil {
+		resm = w.lazy.modifier
+	} else {
+		resm = w.newModifier()
+	}
+
+	w.response.ContentLength = int64(len(w.buf))
+	w.response.Body = ioutil.NopCloser(bytes.NewReader(w.buf))
+	if body, ok := resm.cache().match(w.buf); ok {
+		// The body has been written untouched by a previous modifier
+		w.response.Body = body
+	}
+	if w.spill != nil {
+		// The modifier reads the spilled body without copying it
+		w.response.ContentLength = w.spill.Len()
+		w.response.Body = resm.body.setRaw(w.spill)
+	}
+
+	// Keep a copy of the original response fields for error fallback
+	original := *w.response
+	original.Header = w.response.Header.Clone()
+
+	var err error
+	if w.lazy != nil {
+		// The modifier may have already modified the response header
+		w.lazy.restore(&original)
+		err = w.lazy.resume()
+	} else {
+		err = w.modifier(resm)
+	}
+	if err != nil {
+		if handleError(w.errorHandler, w.writer, w.response.Request, err) {
+			w.headerWritten = true
+			w.Close()
+			return 0, err
+		}
+
+		// Fall back to the unmodified response
+		original.Body = ioutil.NopCloser(bytes.NewReader(w.buf))
+		if w.spill != nil {
+			original.Body = ioutil.NopCloser(w.spill.Reader())
+		}
+		*w.response = original
+	}
+
 	return w.DoWrite()
 }
 
 // Close closes the body readers and flags the interceptor as closed status.
 func (w *WriterInterceptor) Close() {
 	w.mutex.Lock()
+	defer w.mutex.Unlock()
 	if w.closed {
 		return
 	}
 	w.closed = true
 	w.buf = nil
-	w.response.Body.Close()
-	w.mutex.Unlock()
+	if w.response.Body != nil {
+		w.response.Body.Close()
+	}
+	if w.spill != nil {
+		w.spill.Close()
+	}
+	if w.lazy != nil {
+		w.lazy.abort()
+	}
+	if w.body != nil {
+		w.body.close()
+	}
 }
 
 // DoWrite writes the final HTTP response header and body in the real http.ResponseWriter.
 func (w *WriterInterceptor) DoWrite() (int, error) {
-	w.writeHeader()
-	return w.writeBody()
+	if w.closed {
+		return 0, nil
+	}
+
+	if w.response.Body == nil {
+		w.response.Body = http.NoBody
+	}
+	if w.spill != nil {
+		return w.streamBody()
+	}
+
+	buf, err := ioutil.ReadAll(w.response.Body)
+	defer w.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	w.writeHeader(int64(len(buf)))
+	return w.writer.Write(buf)
+}
+
+// streamBody writes the final response header and streams the body in the real http.ResponseWriter,
+// without reading it in memory. The body length is defined by the response ContentLength field.
+func (w *WriterInterceptor) streamBody() (int, error) {
+	defer w.Close()
+
+	w.writeHeader(w.response.ContentLength)
+
+	n, err := io.Copy(w.writer, w.response.Body)
+	return int(n), err
 }
 
-// writeHeader writes the final response header fields.
-func (w *WriterInterceptor) writeHeader() {
+// writeHeader writes the final response header fields,
+// defining the Content-Length header based on the final body length, if known.
+func (w *WriterInterceptor) writeHeader(length int64) {
 	if w.headerWritten || w.closed {
 		return
 	}
 
-	if w.response.StatusCode != 0 {
-		w.writer.WriteHeader(w.response.StatusCode)
-	}
-
 	target := w.writer.Header()
 	for k, v := range w.response.Header {
 		target[k] = v
 	}
 
+	if length < 0 {
+		target.Del("Content-Length")
+	} else if length > 0 || target.Get("Content-Length") != "" {
+		target.Set("Content-Length", strconv.FormatInt(length, 10))
+		target.Del("Transfer-Encoding")
+	}
+
+	if w.response.StatusCode != 0 {
+		w.writer.WriteHeader(w.response.StatusCode)
+	}
+
 	w.headerWritten = true
 }
 
-// writeBody writes the final response body.
-func (w *WriterInterceptor) writeBody() (int, error) {
-	if w.closed {
-		return 0, nil
+// ResponseInterceptor intercepts a given http.Response using a custom response modifier function.
+type ResponseInterceptor struct {
+	Modifier     ResModifierFunc
+	ModifierE    ResModifierFuncE
+	ErrorHandler ErrorHandler
+	Filters      []Filter
+	ResFilters   []ResFilter
+
+	// MaxBodySize defines the maximum response body size buffered in memory.
+	// Zero means no limit.
+	MaxBodySize int64
+
+	// Overflow defines the policy applied to response bodies larger than MaxBodySize.
+	Overflow OverflowPolicy
+
+	// SpillThreshold defines the size above which the response body is buffered
+	// in a temporary file. Zero means MaxBodySize with SpillOverflow,
+	// and no temporary files otherwise.
+	SpillThreshold int64
+
+	// LazyBuffering defers the response body buffering until the modifier calls a body method.
+	// Responses whose modifier only inspects the status and headers are streamed straight through.
+	LazyBuffering bool
+}
+
+// NewResponseInterceptor creates a new response interceptor that passes
+// the intercepted responses to the given response modifier function.
+func NewResponseInterceptor(fn ResModifierFunc) *ResponseInterceptor {
+	return &ResponseInterceptor{Modifier: fn, Filters: []Filter{}, ResFilters: []ResFilter{}}
+}
+
+// ResponseE creates a new response interceptor that passes the intercepted responses
+// to the given error-returning response modifier function.
+// Errors are handled by the interceptor ErrorHandler, or DefaultErrorHandler if not defined.
+func ResponseE(fn ResModifierFuncE) *ResponseInterceptor {
+	return &ResponseInterceptor{ModifierE: fn, Filters: []Filter{}, ResFilters: []ResFilter{}}
+}
+
+// Filter intercepts an HTTP response if and only if the given request filter returns true.
+// Request filters are evaluated before calling the next handler.
+func (s *ResponseInterceptor) Filter(f ...Filter) {
+	s.Filters = append(s.Filters, f...)
+}
+
+// FilterResponse intercepts an HTTP response if and only if the given response filter returns true.
+// Response filters are evaluated before buffering the response body.
+func (s *ResponseInterceptor) FilterResponse(f ...ResFilter) {
+	s.ResFilters = append(s.ResFilters, f...)
+}
+
+// HandleHTTP handles the middleware call chain, intercepting the response data if possible.
+// This methods implements the middleware layer compatible interface.
+func (s *ResponseInterceptor) HandleHTTP(w http.ResponseWriter, r *http.Request, h http.Handler) {
+	if r.Method == "OPTIONS" || r.Method == "HEAD" || !s.filter(r) {
+		h.ServeHTTP(w, r)
+		return
 	}
 
-	buf, err := ioutil.ReadAll(w.response.Body)
-	defer w.Close()
-	if err != nil {
-		return 0, err
+	r = withBodyCache(r)
+	writer := NewWriterInterceptorE(w, r, s.modify)
+	writer.Filter(s.ResFilters...)
+	writer.OnError(s.ErrorHandler)
+	writer.Limit(s.MaxBodySize, s.Overflow)
+	writer.Spill(s.SpillThreshold)
+	writer.Lazy(s.LazyBuffering)
+	defer writer.Close()
+
+	h.ServeHTTP(writer.ResponseWriter(), r)
+	writer.Done()
+}
+
+// modify calls the interceptor modifier functions.
+func (s *ResponseInterceptor) modify(res *ResponseModifier) error {
+	if s.Modifier != nil {
+		s.Modifier(res)
 	}
-	return w.writer.Write(buf)
+	if s.ModifierE != nil {
+		return s.ModifierE(res)
+	}
+	return nil
+}
+
+func (s *ResponseInterceptor) filter(req *http.Request) bool {
+	for _, filter := range s.Filters {
+		if !filter(req) {
+			return false
+		}
+	}
+	return true
 }
 
 // Response intercepts an HTTP response and passes it to the given response modifier function.
 func Response(fn ResModifierFunc) func(http.Handler) http.Handler {
+	interceptor := NewResponseInterceptor(fn)
 	return func(h http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Method == "OPTIONS" || r.Method == "HEAD" {
-				h.ServeHTTP(w, r)
-				return
-			}
-
-			writer := NewWriterInterceptor(w, r, fn)
-			defer h.ServeHTTP(writer, r)
-
-			notifier, ok := w.(http.CloseNotifier)
-			if !ok {
-				return
-			}
-
-			notify := notifier.CloseNotify()
-			go func() {
-				<-notify
-				writer.Close()
-			}()
+			interceptor.HandleHTTP(w, r, h)
 		})
 	}
 }
@@ -2,12 +2,14 @@ package intercept
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"github.com/nbio/st"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 )
@@ -317,3 +319,243 @@ func TestResponseModifierReaderFromStringReader(t *testing.T) {
 	body, _ := ioutil.ReadAll(resp.Body)
 	st.Expect(t, string(body), "Hello")
 }
+
+func TestWriterInterceptorBuffersChunkedBody(t *testing.T) {
+	calls := 0
+	modifier := func(m *ResponseModifier) {
+		calls++
+		str, _ := m.ReadString()
+		m.String(strings.ToUpper(str))
+	}
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, modifier)
+	writer.Write([]byte("hello "))
+	writer.Write([]byte("world"))
+	st.Expect(t, calls, 0)
+	st.Expect(t, recorder.Body.Len(), 0)
+
+	writer.Done()
+	st.Expect(t, calls, 1)
+	st.Expect(t, recorder.Body.String(), "HELLO WORLD")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "11")
+}
+
+func TestWriterInterceptorUpdatesContentLength(t *testing.T) {
+	modifier := func(m *ResponseModifier) {
+		m.String("bye")
+	}
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, modifier)
+	writer.Header().Set("Content-Length", "5")
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.WriteHeader(201)
+	writer.Write([]byte("hello"))
+	writer.Done()
+	st.Expect(t, recorder.Code, 201)
+	st.Expect(t, recorder.Body.String(), "bye")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "3")
+	st.Expect(t, recorder.Header().Get("Content-Type"), "text/plain")
+}
+
+func TestResponse(t *testing.T) {
+	calls := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Transfer-Encoding", "chunked")
+		w.Write([]byte("foo"))
+		w.Write([]byte("bar"))
+	})
+	middleware := Response(func(m *ResponseModifier) {
+		calls++
+		str, _ := m.ReadString()
+		m.String(str + "baz")
+	})
+	recorder := httptest.NewRecorder()
+	middleware(handler).ServeHTTP(recorder, &http.Request{Method: "GET"})
+	st.Expect(t, calls, 1)
+	st.Expect(t, recorder.Body.String(), "foobarbaz")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "9")
+	st.Expect(t, recorder.Header().Get("Transfer-Encoding"), "")
+}
+
+func TestResponseSkipsHeadRequests(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	})
+	middleware := Response(func(m *ResponseModifier) {
+		m.String("bar")
+	})
+	recorder := httptest.NewRecorder()
+	middleware(handler).ServeHTTP(recorder, &http.Request{Method: "HEAD"})
+	st.Expect(t, recorder.Body.String(), "foo")
+}
+
+func TestWriterInterceptorFilteredOut(t *testing.T) {
+	calls := 0
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, func(m *ResponseModifier) {
+		calls++
+	})
+	writer.Filter(ResStatus(200))
+	writer.Header().Set("Content-Length", "5")
+	writer.WriteHeader(404)
+	writer.Write([]byte("hello"))
+	st.Expect(t, recorder.Code, 404)
+	st.Expect(t, recorder.Body.String(), "hello")
+	writer.Done()
+	st.Expect(t, calls, 0)
+	st.Expect(t, recorder.Body.String(), "hello")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "5")
+}
+
+func TestWriterInterceptorFilterContentLength(t *testing.T) {
+	var length int64
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, func(m *ResponseModifier) {})
+	writer.Filter(func(res *http.Response) bool {
+		length = res.ContentLength
+		return true
+	})
+	writer.Header().Set("Content-Length", "5")
+	writer.Write([]byte("hello"))
+	writer.Done()
+	st.Expect(t, length, int64(5))
+}
+
+func TestResponseInterceptor(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Accept"))
+		w.Write([]byte("foo"))
+	})
+	interceptor := NewResponseInterceptor(func(m *ResponseModifier) {
+		m.String("bar")
+	})
+	interceptor.Filter(func(r *http.Request) bool {
+		return r.URL.Path == "/intercept"
+	})
+	interceptor.FilterResponse(ResContentType("application/json"))
+
+	cases := []struct {
+		path, accept, body string
+	}{
+		{"/intercept", "application/json", "bar"},
+		{"/intercept", "text/html", "foo"},
+		{"/other", "application/json", "foo"},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest("GET", c.path, nil)
+		req.Header.Set("Accept", c.accept)
+		recorder := httptest.NewRecorder()
+		interceptor.HandleHTTP(recorder, req, handler)
+		st.Expect(t, recorder.Body.String(), c.body)
+	}
+}
+
+func TestResponseEWithError(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	})
+	interceptor := ResponseE(func(m *ResponseModifier) error {
+		m.String("bar")
+		return errModifier
+	})
+	interceptor.ErrorHandler = ErrorStatus(502)
+	recorder := httptest.NewRecorder()
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Code, 502)
+	st.Expect(t, strings.TrimSpace(recorder.Body.String()), "Bad Gateway")
+}
+
+func TestResponseEWithErrorFallback(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "foo")
+		w.WriteHeader(201)
+		w.Write([]byte("foo"))
+	})
+	interceptor := ResponseE(func(m *ResponseModifier) error {
+		m.Header.Set("X-Foo", "bar")
+		m.Status(500)
+		m.String("bar")
+		return errModifier
+	})
+	interceptor.ErrorHandler = ErrorFallback
+	recorder := httptest.NewRecorder()
+	interceptor.HandleHTTP(recorder, &http.Request{Method: "GET"}, handler)
+	st.Expect(t, recorder.Code, 201)
+	st.Expect(t, recorder.Header().Get("X-Foo"), "foo")
+	st.Expect(t, recorder.Body.String(), "foo")
+}
+
+func TestResponseModifierUpdatesContentLength(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Length", "5")
+	header.Set("Transfer-Encoding", "chunked")
+	resp := &http.Response{Header: header, TransferEncoding: []string{"chunked"}}
+	modifier := NewResponseModifier(&http.Request{}, resp)
+	modifier.String("Hello world")
+	st.Expect(t, resp.ContentLength, int64(11))
+	st.Expect(t, header.Get("Content-Length"), "11")
+	st.Expect(t, header.Get("Transfer-Encoding"), "")
+	st.Expect(t, len(resp.TransferEncoding), 0)
+
+	modifier.Reader(ioutil.NopCloser(strings.NewReader("stream")))
+	st.Expect(t, resp.ContentLength, int64(-1))
+	st.Expect(t, header.Get("Content-Length"), "")
+
+	modifier.Reader(strings.NewReader("Hello"))
+	st.Expect(t, resp.ContentLength, int64(5))
+	st.Expect(t, header.Get("Content-Length"), "5")
+}
+
+func TestWriterInterceptorNilBody(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, func(m *ResponseModifier) {
+		m.Reader(nil)
+	})
+	writer.Write([]byte("hello"))
+	_, err := writer.Done()
+	st.Expect(t, err, nil)
+	st.Expect(t, recorder.Body.Len(), 0)
+}
+
+func TestWriterInterceptorCanceledContext(t *testing.T) {
+	calls := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, req, func(m *ResponseModifier) {
+		calls++
+	})
+	writer.Write([]byte("foo"))
+	cancel()
+	_, err := writer.Write([]byte("bar"))
+	st.Expect(t, err, context.Canceled)
+	_, err = writer.Done()
+	st.Expect(t, err, nil)
+	st.Expect(t, calls, 0)
+	st.Expect(t, recorder.Body.Len(), 0)
+	writer.Close()
+}
+
+func TestWriterInterceptorDoneCanceledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	writer := NewWriterInterceptor(httptest.NewRecorder(), req, func(m *ResponseModifier) {})
+	writer.Write([]byte("foo"))
+	cancel()
+	_, err := writer.Done()
+	st.Expect(t, err, context.Canceled)
+}
+
+func TestResponseModifierContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "foo", "bar")
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/", nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	})
+	var value interface{}
+	Response(func(m *ResponseModifier) {
+		value = m.Context().Value("foo")
+	})(handler).ServeHTTP(httptest.NewRecorder(), req)
+	st.Expect(t, value, "bar")
+	st.Expect(t, NewResponseModifier(nil, &http.Response{}).Context(), context.Background())
+}
@@ -0,0 +1,880 @@
+package intercept
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RuleError reports an invalid rules definition and its location in the rules file.
+type RuleError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+// Error returns the error message prefixed by the rule location.
+func (e *RuleError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "rules"
+	}
+	if e.Line > 0 {
+		return fmt.Sprintf("intercept: %s:%d: %s", file, e.Line, e.Message)
+	}
+	return fmt.Sprintf("intercept: %s: %s", file, e.Message)
+}
+
+// Rules implements a set of declarative interception rules loaded from a YAML or JSON document,
+// such as:
+//
+//	rules:
+//	  - name: legacy api
+//	    match:
+//	      method: [GET, POST]
+//	      path: /api/v1/*rest
+//	      headers: {X-Debug: "1"}
+//	    request:
+//	      - rewrite_path: {pattern: "^/api/v1", replacement: /api/v2}
+//	      - set_header: {X-Forwarded-Version: v1}
+//	  - match:
+//	      path_prefix: /users
+//	      status: [200]
+//	    response:
+//	      - replace_body: {old: foo, new: bar}
+//	      - json_patch: [{op: remove, path: /token}]
+//	      - set_status: 203
+//
+// Supported match conditions are method, path (as in the Path filter), path_prefix,
+// headers and status, which only applies to response actions. Request actions are
+// set_header, remove_header, rewrite_path, replace_body, json_patch and respond,
+// and response actions are set_header, remove_header, rewrite_urls, replace_body, json_patch, set_status and respond.
+// The rewrite_urls action rewrites the response header URLs from the given upstream to the public base URL.
+// The respond action replies with the given status, headers and body or file, which path
+// is relative to the rules file. Every matching rule is applied in order.
+type Rules struct {
+	file     string
+	mutex    sync.RWMutex
+	rules    []*rule
+	request  *RequestInterceptor
+	response *ResponseInterceptor
+}
+
+// ParseRules parses the given YAML or JSON rules document.
+func ParseRules(data []byte) (*Rules, error) {
+	rules, err := parseRules(data, "")
+	if err != nil {
+		return nil, err
+	}
+	return newRules("", rules), nil
+}
+
+// LoadRules loads the rules defined in the given YAML or JSON file.
+func LoadRules(file string) (*Rules, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseRules(data, file)
+	if err != nil {
+		return nil, err
+	}
+	return newRules(file, rules), nil
+}
+
+func newRules(file string, rules []*rule) *Rules {
+	r := &Rules{file: file, rules: rules}
+	r.request = RequestE(r.modifyRequest)
+	r.response = ResponseE(r.modifyResponse)
+	r.response.Filter(r.matchResponse)
+	r.response.FilterResponse(r.filterResponse)
+	return r
+}
+
+// Reload reloads the rules file. The current rules are kept if the file is invalid or empty,
+// as empty files are usually being written.
+func (r *Rules) Reload() error {
+	if r.file == "" {
+		return errors.New("intercept: rules not loaded from a file")
+	}
+
+	data, err := ioutil.ReadFile(r.file)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &RuleError{File: r.file, Message: "empty rules document"}
+	}
+	rules, err := parseRules(data, r.file)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.rules = rules
+	r.mutex.Unlock()
+	return nil
+}
+
+// Watch polls the rules file with the given interval, reloading the rules when it changes.
+// Changes are reloaded once the file is not empty and its size and modification time
+// are the same in two polls, so files being written are not loaded partially.
+// Reload errors are passed to the given function, if not nil.
+// Watching stops when the returned function is called.
+func (r *Rules) Watch(interval time.Duration, onError func(error)) (stop func()) {
+	done := make(chan struct{})
+	last, _ := os.Stat(r.file)
+	var pending os.FileInfo
+
+	go func() {
+		// Polls are spaced by a timer, as late ticker ticks could be delivered back to back
+		timer := time.NewTimer(interval)
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-timer.C:
+				timer.Reset(interval)
+			}
+
+			info, err := os.Stat(r.file)
+			if err != nil {
+				// Report a missing file only once, as editors may replace it while saving
+				if last != nil && onError != nil {
+					onError(err)
+				}
+				last, pending = nil, nil
+				continue
+			}
+			if sameFileInfo(info, last) {
+				pending = nil
+				continue
+			}
+			if info.Size() == 0 || !sameFileInfo(info, pending) {
+				// Wait for the next poll, as the file may still be being written
+				pending = info
+				continue
+			}
+
+			last, pending = info, nil
+			if err := r.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// sameFileInfo reports whether both file infos define the same size and modification time.
+func sameFileInfo(a, b os.FileInfo) bool {
+	return a != nil && b != nil && a.ModTime().Equal(b.ModTime()) && a.Size() == b.Size()
+}
+
+// Request returns the interceptor applying the request actions.
+func (r *Rules) Request() *RequestInterceptor {
+	return r.request
+}
+
+// Response returns the interceptor applying the response actions.
+// Used on its own, rules are matched against the request as modified by the request actions.
+func (r *Rules) Response() *ResponseInterceptor {
+	return r.response
+}
+
+// matchedRulesKey is the context key used to store the rules matching the original request.
+type matchedRulesKey struct {
+	rules *Rules
+}
+
+// HandleHTTP handles the middleware call chain, applying both request and response actions.
+// Rules are matched once against the original request, so response actions still apply
+// when request actions modify the matched request fields.
+// This methods implements the middleware layer compatible interface.
+func (r *Rules) HandleHTTP(w http.ResponseWriter, req *http.Request, h http.Handler) {
+	req = req.WithContext(context.WithValue(req.Context(), matchedRulesKey{r}, r.match(req)))
+	r.request.HandleHTTP(w, req, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.response.HandleHTTP(w, req, h)
+	}))
+}
+
+func (r *Rules) current() []*rule {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.rules
+}
+
+// match returns the current rules matching the given request.
+func (r *Rules) match(req *http.Request) []*rule {
+	var matched []*rule
+	for _, rule := range r.current() {
+		if rule.match(req) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// matched returns the rules matching the original request, if stored in its context by HandleHTTP,
+// or the current rules matching the given request otherwise.
+func (r *Rules) matched(req *http.Request) []*rule {
+	if matched, ok := req.Context().Value(matchedRulesKey{r}).([]*rule); ok {
+		return matched
+	}
+	return r.match(req)
+}
+
+// modifyRequest applies the request actions of the matching rules.
+func (r *Rules) modifyRequest(req *RequestModifier) error {
+	for _, rule := range r.matched(req.Request) {
+		if len(rule.request) == 0 {
+			continue
+		}
+		for _, action := range rule.request {
+			if err := action.request(req); err != nil {
+				return err
+			}
+			if req.response != nil || req.aborted {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// modifyResponse applies the response actions of the matching rules.
+func (r *Rules) modifyResponse(res *ResponseModifier) error {
+	for _, rule := range r.matched(res.Request) {
+		if len(rule.response) == 0 || !rule.matchResponse(res.Response) {
+			continue
+		}
+		for _, action := range rule.response {
+			if err := action.response(res); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchResponse reports whether any response rule matches the given request,
+// so the other responses are not buffered.
+func (r *Rules) matchResponse(req *http.Request) bool {
+	for _, rule := range r.matched(req) {
+		if len(rule.response) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// filterResponse reports whether any response rule matches the given response status,
+// so the other responses are not buffered.
+func (r *Rules) filterResponse(res *http.Response) bool {
+	for _, rule := range r.matched(res.Request) {
+		if len(rule.response) > 0 && rule.matchResponse(res) {
+			return true
+		}
+	}
+	return false
+}
+
+// rule represents a compiled interception rule.
+type rule struct {
+	name       string
+	filters    []Filter
+	resFilters []ResFilter
+	request    []ruleAction
+	response   []ruleAction
+}
+
+func (r *rule) match(req *http.Request) bool {
+	for _, filter := range r.filters {
+		if !filter(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *rule) matchResponse(res *http.Response) bool {
+	for _, filter := range r.resFilters {
+		if !filter(res) {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleAction represents a compiled rule action for the request and response phases.
+// Actions not supported in a phase define a nil function.
+type ruleAction struct {
+	request  func(*RequestModifier) error
+	response func(*ResponseModifier) error
+}
+
+// ruleParser compiles a rules document, reporting errors with their location.
+type ruleParser struct {
+	file string
+}
+
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func parseRules(data []byte, file string) ([]*rule, error) {
+	p := &ruleParser{file: file}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		if match := yamlErrorLine.FindStringSubmatch(err.Error()); match != nil {
+			line, _ := strconv.Atoi(match[1])
+			return nil, &RuleError{File: file, Line: line, Message: match[2]}
+		}
+		return nil, &RuleError{File: file, Message: err.Error()}
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	fields, err := p.fields(doc.Content[0], "rules")
+	if err != nil {
+		return nil, err
+	}
+	list := fields["rules"]
+	if list == nil {
+		return nil, nil
+	}
+	if list.Kind != yaml.SequenceNode {
+		return nil, p.errorf(list, "rules must be a list")
+	}
+
+	var rules []*rule
+	for _, node := range list.Content {
+		rule, err := p.rule(node)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (p *ruleParser) errorf(node *yaml.Node, format string, args ...interface{}) error {
+	return &RuleError{File: p.file, Line: node.Line, Message: fmt.Sprintf(format, args...)}
+}
+
+// fields returns the values of the given mapping node, failing on unknown or duplicated keys.
+func (p *ruleParser) fields(node *yaml.Node, allowed ...string) (map[string]*yaml.Node, error) {
+	node = resolveNode(node)
+	if node.Kind != yaml.MappingNode {
+		return nil, p.errorf(node, "expected a mapping")
+	}
+
+	fields := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolveNode(node.Content[i+1])
+		if !contains(allowed, key.Value) {
+			return nil, p.errorf(key, "unknown field %q", key.Value)
+		}
+		if _, ok := fields[key.Value]; ok {
+			return nil, p.errorf(key, "duplicated field %q", key.Value)
+		}
+		fields[key.Value] = value
+	}
+	return fields, nil
+}
+
+// strings returns the values of the given scalar or list of scalars node.
+func (p *ruleParser) strings(node *yaml.Node) ([]string, error) {
+	if node.Kind == yaml.ScalarNode {
+		return []string{node.Value}, nil
+	}
+	if node.Kind != yaml.SequenceNode {
+		return nil, p.errorf(node, "expected a value or a list of values")
+	}
+
+	var values []string
+	for _, item := range node.Content {
+		item = resolveNode(item)
+		if item.Kind != yaml.ScalarNode {
+			return nil, p.errorf(item, "expected a value")
+		}
+		values = append(values, item.Value)
+	}
+	return values, nil
+}
+
+// stringMap returns the values of the given mapping of scalars node.
+func (p *ruleParser) stringMap(node *yaml.Node) (map[string]string, error) {
+	if node.Kind != yaml.MappingNode {
+		return nil, p.errorf(node, "expected a mapping")
+	}
+
+	values := make(map[string]string)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := resolveNode(node.Content[i+1])
+		if value.Kind != yaml.ScalarNode {
+			return nil, p.errorf(value, "expected a value")
+		}
+		values[node.Content[i].Value] = value.Value
+	}
+	return values, nil
+}
+
+// status returns the HTTP status code defined by the given node.
+func (p *ruleParser) status(node *yaml.Node) (int, error) {
+	status, err := strconv.Atoi(node.Value)
+	if node.Kind != yaml.ScalarNode || err != nil || status < 100 || status > 599 {
+		return 0, p.errorf(node, "invalid status code %q", node.Value)
+	}
+	return status, nil
+}
+
+func (p *ruleParser) rule(node *yaml.Node) (*rule, error) {
+	fields, err := p.fields(node, "name", "match", "request", "response")
+	if err != nil {
+		return nil, err
+	}
+
+	r := &rule{}
+	if fields["name"] != nil {
+		r.name = fields["name"].Value
+	}
+	if fields["request"] == nil && fields["response"] == nil {
+		return nil, p.errorf(node, "rule defines no request or response actions")
+	}
+	if match := fields["match"]; match != nil {
+		if err := p.match(r, match); err != nil {
+			return nil, err
+		}
+	}
+	if actions := fields["request"]; actions != nil {
+		if len(r.resFilters) > 0 {
+			return nil, p.errorf(actions, "request actions cannot match a response status")
+		}
+		if r.request, err = p.actions(actions, "request"); err != nil {
+			return nil, err
+		}
+	}
+	if actions := fields["response"]; actions != nil {
+		if r.response, err = p.actions(actions, "response"); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func (p *ruleParser) match(r *rule, node *yaml.Node) error {
+	fields, err := p.fields(node, "method", "path", "path_prefix", "headers", "status")
+	if err != nil {
+		return err
+	}
+
+	if node := fields["method"]; node != nil {
+		methods, err := p.strings(node)
+		if err != nil {
+			return err
+		}
+		r.filters = append(r.filters, Method(methods...))
+	}
+	if node := fields["path"]; node != nil {
+		r.filters = append(r.filters, Path(node.Value))
+	}
+	if node := fields["path_prefix"]; node != nil {
+		r.filters = append(r.filters, PathPrefix(node.Value))
+	}
+	if node := fields["headers"]; node != nil {
+		headers, err := p.stringMap(node)
+		if err != nil {
+			return err
+		}
+		for key, value := range headers {
+			r.filters = append(r.filters, HeaderEquals(key, value))
+		}
+	}
+	if node := fields["status"]; node != nil {
+		if node.Kind == yaml.ScalarNode {
+			node = &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{node}}
+		}
+		var codes []int
+		for _, item := range node.Content {
+			code, err := p.status(resolveNode(item))
+			if err != nil {
+				return err
+			}
+			codes = append(codes, code)
+		}
+		r.resFilters = append(r.resFilters, ResStatus(codes...))
+	}
+	return nil
+}
+
+func (p *ruleParser) actions(node *yaml.Node, phase string) ([]ruleAction, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, p.errorf(node, "%s actions must be a list", phase)
+	}
+
+	var actions []ruleAction
+	for _, item := range node.Content {
+		item = resolveNode(item)
+		if item.Kind != yaml.MappingNode || len(item.Content) != 2 {
+			return nil, p.errorf(item, "action must define a single operation")
+		}
+
+		key, value := item.Content[0], resolveNode(item.Content[1])
+		action, err := p.action(key.Value, value)
+		if err != nil {
+			return nil, err
+		}
+		if action == nil {
+			return nil, p.errorf(key, "unknown action %q", key.Value)
+		}
+		if (phase == "request" && action.request == nil) || (phase == "response" && action.response == nil) {
+			return nil, p.errorf(key, "action %q is not supported in %s rules", key.Value, phase)
+		}
+		actions = append(actions, *action)
+	}
+	return actions, nil
+}
+
+// action compiles the given action. It returns nil if the action is unknown.
+func (p *ruleParser) action(name string, node *yaml.Node) (*ruleAction, error) {
+	switch name {
+	case "set_header":
+		headers, err := p.stringMap(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ruleAction{
+			request:  func(req *RequestModifier) error { setHeaders(req.Header, headers); return nil },
+			response: func(res *ResponseModifier) error { setHeaders(res.Header, headers); return nil },
+		}, nil
+
+	case "remove_header":
+		keys, err := p.strings(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ruleAction{
+			request:  func(req *RequestModifier) error { removeHeaders(req.Header, keys); return nil },
+			response: func(res *ResponseModifier) error { removeHeaders(res.Header, keys); return nil },
+		}, nil
+
+	case "rewrite_path":
+		fields, err := p.fields(node, "pattern", "replacement")
+		if err != nil {
+			return nil, err
+		}
+		if fields["pattern"] == nil {
+			return nil, p.errorf(node, "rewrite_path requires a pattern")
+		}
+		re, err := regexp.Compile(fields["pattern"].Value)
+		if err != nil {
+			return nil, p.errorf(fields["pattern"], "invalid pattern: %s", err)
+		}
+		replacement := ""
+		if fields["replacement"] != nil {
+			replacement = fields["replacement"].Value
+		}
+		return &ruleAction{
+			request: func(req *RequestModifier) error { req.RewritePath(re, replacement); return nil },
+		}, nil
+
+	case "rewrite_urls":
+		fields, err := p.fields(node, "upstream", "public")
+		if err != nil {
+			return nil, err
+		}
+		upstream, err := p.baseURL(node, fields, "upstream")
+		if err != nil {
+			return nil, err
+		}
+		public, err := p.baseURL(node, fields, "public")
+		if err != nil {
+			return nil, err
+		}
+		return &ruleAction{
+			response: func(res *ResponseModifier) error { res.RewriteURLs(upstream, public); return nil },
+		}, nil
+
+	case "replace_body":
+		fields, err := p.fields(node, "old", "new")
+		if err != nil {
+			return nil, err
+		}
+		if fields["old"] == nil || fields["old"].Value == "" {
+			return nil, p.errorf(node, "replace_body requires an old value")
+		}
+		old := []byte(fields["old"].Value)
+		var replacement []byte
+		if fields["new"] != nil {
+			replacement = []byte(fields["new"].Value)
+		}
+		return &ruleAction{
+			request: func(req *RequestModifier) error {
+				buf, err := req.ReadBytes()
+				if err == nil && bytes.Contains(buf, old) {
+					req.Bytes(bytes.ReplaceAll(buf, old, replacement))
+				}
+				return err
+			},
+			response: func(res *ResponseModifier) error {
+				buf, err := res.ReadBytes()
+				if err == nil && bytes.Contains(buf, old) {
+					res.Bytes(bytes.ReplaceAll(buf, old, replacement))
+				}
+				return err
+			},
+		}, nil
+
+	case "json_patch":
+		patch, err := p.jsonPatch(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ruleAction{
+			request:  func(req *RequestModifier) error { return req.JSONPatch(patch) },
+			response: func(res *ResponseModifier) error { return res.JSONPatch(patch) },
+		}, nil
+
+	case "set_status":
+		status, err := p.status(node)
+		if err != nil {
+			return nil, err
+		}
+		return &ruleAction{
+			response: func(res *ResponseModifier) error { res.Status(status); return nil },
+		}, nil
+
+	case "respond":
+		return p.respond(node)
+	}
+	return nil, nil
+}
+
+// baseURL parses the given required URL field of the rewrite_urls action.
+func (p *ruleParser) baseURL(node *yaml.Node, fields map[string]*yaml.Node, name string) (*url.URL, error) {
+	if fields[name] == nil {
+		return nil, p.errorf(node, "rewrite_urls requires a %s URL", name)
+	}
+	u, err := url.Parse(fields[name].Value)
+	if err != nil {
+		return nil, p.errorf(fields[name], "invalid %s URL: %s", name, err)
+	}
+	return u, nil
+}
+
+// respond compiles the respond action, reading the fixture file, if any.
+func (p *ruleParser) respond(node *yaml.Node) (*ruleAction, error) {
+	fields, err := p.fields(node, "status", "headers", "body", "file")
+	if err != nil {
+		return nil, err
+	}
+
+	status := http.StatusOK
+	if fields["status"] != nil {
+		if status, err = p.status(fields["status"]); err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]string)
+	if fields["headers"] != nil {
+		if headers, err = p.stringMap(fields["headers"]); err != nil {
+			return nil, err
+		}
+	}
+
+	var body []byte
+	switch {
+	case fields["body"] != nil && fields["file"] != nil:
+		return nil, p.errorf(node, "respond cannot define both body and file")
+	case fields["body"] != nil:
+		body = []byte(fields["body"].Value)
+	case fields["file"] != nil:
+		file := fields["file"].Value
+		if !filepath.IsAbs(file) && p.file != "" {
+			file = filepath.Join(filepath.Dir(p.file), file)
+		}
+		if body, err = ioutil.ReadFile(file); err != nil {
+			return nil, p.errorf(fields["file"], "cannot read file: %s", err)
+		}
+		if !hasHeader(headers, "Content-Type") {
+			if contentType := mime.TypeByExtension(filepath.Ext(file)); contentType != "" {
+				headers["Content-Type"] = contentType
+			}
+		}
+	}
+
+	return &ruleAction{
+		request: func(req *RequestModifier) error {
+			res := req.Respond(status, "")
+			setHeaders(res.Header, headers)
+			res.Bytes(body)
+			return nil
+		},
+		response: func(res *ResponseModifier) error {
+			res.Status(status)
+			setHeaders(res.Header, headers)
+			res.Bytes(body)
+			return nil
+		},
+	}, nil
+}
+
+// jsonPatch validates and converts the given JSON patch node into a JSON document.
+func (p *ruleParser) jsonPatch(node *yaml.Node) ([]byte, error) {
+	if node.Kind != yaml.SequenceNode {
+		return nil, p.errorf(node, "json_patch must be a list of operations")
+	}
+
+	for _, item := range node.Content {
+		fields, err := p.fields(item, "op", "path", "from", "value")
+		if err != nil {
+			return nil, err
+		}
+		op := fields["op"]
+		if op == nil {
+			return nil, p.errorf(item, "operation requires an op")
+		}
+		if !contains([]string{"add", "remove", "replace", "move", "copy", "test"}, op.Value) {
+			return nil, p.errorf(op, "unknown operation %q", op.Value)
+		}
+		for _, key := range []string{"path", "from"} {
+			if fields[key] == nil {
+				continue
+			}
+			if _, err := parseJSONPointer(fields[key].Value); err != nil {
+				return nil, p.errorf(fields[key], "invalid %s: %q", key, fields[key].Value)
+			}
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := p.toJSON(buf, node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// toJSON writes the given YAML node as JSON, preserving the key order and number precision.
+func (p *ruleParser) toJSON(buf *bytes.Buffer, node *yaml.Node) error {
+	node = resolveNode(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		buf.WriteByte('{')
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := encodeJSONString(buf, node.Content[i].Value); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := p.toJSON(buf, node.Content[i+1]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+	case yaml.SequenceNode:
+		buf.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := p.toJSON(buf, item); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+		return nil
+	}
+
+	switch node.ShortTag() {
+	case "!!null":
+		buf.WriteString("null")
+		return nil
+	case "!!int", "!!float":
+		if jsonNumber.MatchString(node.Value) {
+			buf.WriteString(node.Value)
+			return nil
+		}
+	case "!!bool":
+	default:
+		return encodeJSONString(buf, node.Value)
+	}
+
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return p.errorf(node, "invalid value %q", node.Value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return p.errorf(node, "invalid JSON value %q", node.Value)
+	}
+	buf.Write(data)
+	return nil
+}
+
+// resolveNode returns the node referenced by the given alias or document node.
+func resolveNode(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode || (node.Kind == yaml.DocumentNode && len(node.Content) > 0) {
+		if node.Kind == yaml.AliasNode {
+			node = node.Alias
+		} else {
+			node = node.Content[0]
+		}
+	}
+	return node
+}
+
+func setHeaders(header http.Header, values map[string]string) {
+	for key, value := range values {
+		header.Set(key, value)
+	}
+}
+
+func hasHeader(values map[string]string, key string) bool {
+	for k := range values {
+		if http.CanonicalHeaderKey(k) == key {
+			return true
+		}
+	}
+	return false
+}
+
+func removeHeaders(header http.Header, keys []string) {
+	for _, key := range keys {
+		header.Del(key)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
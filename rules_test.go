@@ -0,0 +1,204 @@
+package intercept
+
+import (
+	"errors"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rulesDocument = `
+rules:
+  - name: legacy api
+    match:
+      method: [GET, POST]
+      path: /api/v1/*rest
+      headers: {X-Debug: "1"}
+    request:
+      - rewrite_path: {pattern: "^/api/v1", replacement: /api/v2}
+      - set_header: {X-Version: v1}
+      - remove_header: X-Debug
+  - match:
+      path_prefix: /api
+      status: 200
+    response:
+      - replace_body: {old: foo, new: bar}
+      - json_patch:
+          - {op: add, path: /id, value: 12345678901234567890}
+          - {op: remove, path: /token}
+      - set_header: {X-Modified: "true"}
+      - set_status: 203
+`
+
+func TestRules(t *testing.T) {
+	rules, err := ParseRules([]byte(rulesDocument))
+	st.Assert(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com/api/v1/users", nil)
+	req.Header.Set("X-Debug", "1")
+	w := serve(rules, req, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, r.URL.Path, "/api/v2/users")
+		st.Expect(t, r.Header.Get("X-Version"), "v1")
+		st.Expect(t, r.Header.Get("X-Debug"), "")
+		w.Write([]byte(`{"name":"foo","token":"secret"}`))
+	})
+
+	st.Expect(t, w.Code, 203)
+	st.Expect(t, w.Header().Get("X-Modified"), "true")
+	st.Expect(t, w.Body.String(), `{"name":"bar","id":12345678901234567890}`)
+}
+
+func TestRulesNotMatching(t *testing.T) {
+	rules, err := ParseRules([]byte(rulesDocument))
+	st.Assert(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com/api/v1/users", nil)
+	w := httptest.NewRecorder()
+	rules.HandleHTTP(w, req, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		st.Expect(t, r.URL.Path, "/api/v1/users")
+		rw.WriteHeader(404)
+		rw.Write([]byte("foo"))
+		// Responses with other status codes are not buffered
+		st.Expect(t, w.Body.String(), "foo")
+	}))
+	st.Expect(t, w.Code, 404)
+	st.Expect(t, w.Body.String(), "foo")
+}
+
+func TestRulesMatchOriginalRequest(t *testing.T) {
+	rules, err := ParseRules([]byte(`
+rules:
+  - match: {path_prefix: /v1}
+    request:
+      - rewrite_path: {pattern: "^/v1", replacement: /v2}
+    response:
+      - set_header: {X-Version: v1}
+`))
+	st.Assert(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com/v1/users", nil)
+	w := serve(rules, req, func(w http.ResponseWriter, r *http.Request) {
+		st.Expect(t, r.URL.Path, "/v2/users")
+	})
+	st.Expect(t, w.Header().Get("X-Version"), "v1")
+}
+
+func TestRulesRespondFixture(t *testing.T) {
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(`{"name":"Rick"}`), 0644)
+	file := filepath.Join(dir, "rules.yml")
+	ioutil.WriteFile(file, []byte(`{"rules": [{"match": {"path": "/users/:id"}, "request": [{"respond": {"status": 201, "file": "user.json"}}]}]}`), 0644)
+
+	rules, err := LoadRules(file)
+	st.Assert(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "http://example.com/users/1", nil)
+	w := serve(rules, req, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	})
+	st.Expect(t, w.Code, 201)
+	st.Expect(t, w.Header().Get("Content-Type"), "application/json")
+	st.Expect(t, w.Body.String(), `{"name":"Rick"}`)
+}
+
+func TestRulesRewriteURLs(t *testing.T) {
+	rules, err := ParseRules([]byte("rules:\n  - response:\n      - rewrite_urls: {upstream: http://backend/app, public: https://example.com/api}\n"))
+	st.Assert(t, err, nil)
+
+	req, _ := http.NewRequest("GET", "https://example.com/api/", nil)
+	w := serve(rules, req, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/app/login")
+		w.WriteHeader(302)
+	})
+	st.Expect(t, w.Code, 302)
+	st.Expect(t, w.Header().Get("Location"), "/api/login")
+}
+
+func TestRulesValidation(t *testing.T) {
+	cases := []struct {
+		document string
+		line     int
+		message  string
+	}{
+		{"rules:\n  - match: {path: /}\n    request:\n      - unknown: foo\n", 4, `unknown action "unknown"`},
+		{"rules:\n  - match: {verb: GET}\n    request: []\n", 2, `unknown field "verb"`},
+		{"rules:\n  - name: foo\n", 2, "rule defines no request or response actions"},
+		{"rules:\n  - response:\n      - rewrite_path: {pattern: foo}\n", 3, `action "rewrite_path" is not supported in response rules`},
+		{"rules:\n  - request:\n      - rewrite_path: {pattern: \"(\"}\n", 3, "invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{"rules:\n  - response:\n      - rewrite_urls: {upstream: http://backend}\n", 3, "rewrite_urls requires a public URL"},
+		{"rules:\n  - response:\n      - set_status: 999\n", 3, `invalid status code "999"`},
+		{"rules:\n  - response:\n      - json_patch:\n          - {op: drop, path: /a}\n", 4, `unknown operation "drop"`},
+		{"rules:\n  - match: {status: 200}\n    request: []\n", 3, "request actions cannot match a response status"},
+		{"rules:\n  - request:\n      - respond: {file: missing.json}\n", 3, "cannot read file: open missing.json: no such file or directory"},
+		{"rules:\n  - request: [\n", 2, "did not find expected node content"},
+	}
+
+	for _, c := range cases {
+		_, err := ParseRules([]byte(c.document))
+		var ruleErr *RuleError
+		st.Assert(t, errors.As(err, &ruleErr), true)
+		st.Expect(t, ruleErr.Line, c.line)
+		st.Expect(t, ruleErr.Message, c.message)
+	}
+}
+
+func TestRulesWatch(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "rules.yml")
+	write := func(status string) {
+		// Truncate and write the file in place, as most editors do
+		document := "rules:\n  - response:\n      - set_status: " + status + "\n"
+		ioutil.WriteFile(file, []byte(document), 0644)
+	}
+	write("201")
+
+	rules, err := LoadRules(file)
+	st.Assert(t, err, nil)
+	errs := make(chan error, 10)
+	stop := rules.Watch(5*time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	status := func() int {
+		req, _ := http.NewRequest("GET", "http://example.com/", nil)
+		return serve(rules, req, func(w http.ResponseWriter, r *http.Request) {}).Code
+	}
+	st.Expect(t, status(), 201)
+
+	// Ensure a different modification time on coarse-grained file systems
+	later := time.Now().Add(time.Second)
+	write("202")
+	os.Chtimes(file, later, later)
+	waitFor(t, func() bool { return status() == 202 })
+
+	// Invalid rules are reported and the current ones are kept
+	write("abc")
+	os.Chtimes(file, later.Add(time.Second), later.Add(time.Second))
+	select {
+	case err := <-errs:
+		st.Expect(t, strings.Contains(err.Error(), `invalid status code "abc"`), true)
+	case <-time.After(time.Second):
+		t.Fatal("expected a reload error")
+	}
+	st.Expect(t, status(), 202)
+
+	// Empty files are rejected
+	ioutil.WriteFile(file, nil, 0644)
+	err = rules.Reload()
+	st.Expect(t, err.Error(), "intercept: "+file+": empty rules document")
+	st.Expect(t, status(), 202)
+}
+
+func waitFor(t *testing.T, fn func() bool) {
+	deadline := time.Now().Add(time.Second)
+	for !fn() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,189 @@
+package intercept
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// spillBuffer buffers data in memory up to a threshold, and in a temporary file above it.
+// The temporary file is removed when the buffer is closed or the given context is done.
+// A zero threshold keeps the data in memory.
+type spillBuffer struct {
+	ctx       context.Context
+	threshold int64
+	size      int64
+	mem       []byte
+	file      *os.File
+	once      sync.Once
+}
+
+func newSpillBuffer(ctx context.Context, threshold int64) *spillBuffer {
+	return &spillBuffer{ctx: ctx, threshold: threshold}
+}
+
+// Write appends the given bytes to the buffer, spilling them to disk when exceeding the threshold.
+func (b *spillBuffer) Write(p []byte) (int, error) {
+	if b.file == nil && b.threshold > 0 && b.size+int64(len(p)) > b.threshold {
+		if err := b.spill(); err != nil {
+			return 0, err
+		}
+	}
+
+	if b.file != nil {
+		n, err := b.file.Write(p)
+		b.size += int64(n)
+		return n, err
+	}
+
+	b.mem = append(b.mem, p...)
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+// spill moves the buffered data to a temporary file.
+func (b *spillBuffer) spill() error {
+	file, err := ioutil.TempFile("", "intercept-body-")
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(b.mem); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return err
+	}
+
+	b.file = file
+	b.mem = nil
+	if b.ctx != nil {
+		context.AfterFunc(b.ctx, func() { b.Close() })
+	}
+	return nil
+}
+
+// Len returns the number of buffered bytes.
+func (b *spillBuffer) Len() int64 {
+	return b.size
+}
+
+// Reader returns a new seekable reader of the buffered data.
+func (b *spillBuffer) Reader() io.ReadSeeker {
+	if b.file != nil {
+		return io.NewSectionReader(b.file, 0, b.size)
+	}
+	return bytes.NewReader(b.mem)
+}
+
+// Close removes the temporary file, if any.
+func (b *spillBuffer) Close() error {
+	var err error
+	b.once.Do(func() {
+		if b.file != nil {
+			err = b.file.Close()
+			os.Remove(b.file.Name())
+		}
+	})
+	return err
+}
+
+// bodyBuffer buffers a modifier body in spill buffers, so it can be read repeatedly.
+type bodyBuffer struct {
+	// threshold defines the size above which the body is buffered in a temporary file.
+	threshold int64
+
+	// limit defines the maximum size of the raw and decoded body, if greater than zero.
+	limit int64
+
+	// source stores the body reading the raw buffer, to detect if it has been replaced.
+	source io.ReadCloser
+
+	// raw and decoded store the body as sent and decoded based on the Content-Encoding header.
+	raw     *spillBuffer
+	decoded *spillBuffer
+
+	// buffers stores every allocated buffer, so they can be closed once done.
+	buffers []*spillBuffer
+}
+
+// readSeeker buffers the given body, unless already buffered, and returns a new seekable reader
+// of its decoded content. The body is replaced by a reader of the buffered raw content.
+// If the raw or decoded body exceeds the buffer limit, a BodyTooLargeError is returned.
+func (b *bodyBuffer) readSeeker(ctx context.Context, header http.Header, body *io.ReadCloser) (io.ReadSeeker, error) {
+	if b.raw == nil || *body != b.source {
+		raw := b.buffer(ctx)
+		if *body != nil {
+			_, err := io.Copy(raw, limitReader(*body, b.limit))
+			if err == nil {
+				err = checkLimit(raw.Len(), b.limit)
+			}
+			if err != nil {
+				*body = &readCloser{io.MultiReader(raw.Reader(), *body), *body}
+				return nil, err
+			}
+		}
+		b.raw = raw
+		b.decoded = nil
+	}
+
+	// Rewind the body, as it may have been read since buffered
+	*body = b.rewind()
+
+	if b.decoded == nil {
+		list, ok := contentCodecs(header)
+		if !ok || len(list) == 0 || b.raw.Len() == 0 {
+			b.decoded = b.raw
+		} else {
+			var reader io.Reader = b.raw.Reader()
+			for i := len(list) - 1; i >= 0; i-- {
+				rc, err := list[i].NewReader(reader)
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				reader = rc
+			}
+			decoded := b.buffer(ctx)
+			if _, err := io.Copy(decoded, limitReader(reader, b.limit)); err != nil {
+				return nil, err
+			}
+			if err := checkLimit(decoded.Len(), b.limit); err != nil {
+				return nil, err
+			}
+			b.decoded = decoded
+		}
+	}
+
+	return b.decoded.Reader(), nil
+}
+
+// setRaw defines the given buffer as the raw body content, returning a body that reads it.
+func (b *bodyBuffer) setRaw(raw *spillBuffer) io.ReadCloser {
+	b.raw = raw
+	b.decoded = nil
+	return b.rewind()
+}
+
+// rewind returns a new body that reads the raw buffer from the start.
+func (b *bodyBuffer) rewind() io.ReadCloser {
+	b.source = &readCloser{b.raw.Reader(), ioutil.NopCloser(nil)}
+	return b.source
+}
+
+// buffer allocates a new spill buffer.
+func (b *bodyBuffer) buffer(ctx context.Context) *spillBuffer {
+	buf := newSpillBuffer(ctx, b.threshold)
+	b.buffers = append(b.buffers, buf)
+	return buf
+}
+
+// close removes the temporary files of the allocated buffers.
+func (b *bodyBuffer) close() {
+	for _, buf := range b.buffers {
+		buf.Close()
+	}
+	b.buffers = nil
+}
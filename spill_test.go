@@ -0,0 +1,142 @@
+package intercept
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"github.com/nbio/st"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// tempFiles returns the number of files in the temporary directory.
+func tempFiles() int {
+	files, _ := ioutil.ReadDir(os.TempDir())
+	return len(files)
+}
+
+func TestSpillBuffer(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	buf := newSpillBuffer(nil, 8)
+	buf.Write([]byte("Hello"))
+	st.Expect(t, tempFiles(), 0)
+	buf.Write([]byte(" world"))
+	st.Expect(t, tempFiles(), 1)
+	st.Expect(t, buf.Len(), int64(11))
+
+	for i := 0; i < 2; i++ {
+		data, err := ioutil.ReadAll(buf.Reader())
+		st.Expect(t, err, nil)
+		st.Expect(t, string(data), "Hello world")
+	}
+
+	buf.Close()
+	st.Expect(t, tempFiles(), 0)
+}
+
+func TestSpillBufferContextDone(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	buf := newSpillBuffer(ctx, 1)
+	buf.Write([]byte("Hello"))
+	st.Expect(t, tempFiles(), 1)
+
+	cancel()
+	waitFor(t, func() bool { return tempFiles() == 0 })
+}
+
+func TestResponseModifierReadSeeker(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	interceptor := ResponseE(func(m *ResponseModifier) error {
+		st.Expect(t, tempFiles(), 1)
+		for i := 0; i < 2; i++ {
+			reader, err := m.ReadSeeker()
+			st.Expect(t, err, nil)
+			data, _ := ioutil.ReadAll(reader)
+			st.Expect(t, string(data), "Hello world")
+		}
+		return nil
+	})
+	interceptor.SpillThreshold = 4
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello "))
+		w.Write([]byte("world"))
+	})
+	st.Expect(t, w.Body.String(), "Hello world")
+	st.Expect(t, tempFiles(), 0)
+}
+
+func TestResponseModifierDecodeJSONSpilled(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	interceptor := ResponseE(func(m *ResponseModifier) error {
+		data := map[string]string{}
+		if err := m.DecodeJSON(&data); err != nil {
+			return err
+		}
+		data["hello"] = strings.ToUpper(data["hello"])
+		return m.JSON(data)
+	})
+	interceptor.SpillThreshold = 4
+
+	w := serve(interceptor, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"hello": "world"}`))
+	})
+	st.Expect(t, w.Body.String(), "{\"hello\":\"WORLD\"}\n")
+	st.Expect(t, tempFiles(), 0)
+}
+
+func TestResponseModifierReadSeekerEncoded(t *testing.T) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	gz.Write([]byte("Hello world"))
+	gz.Close()
+
+	res := &http.Response{Header: http.Header{"Content-Encoding": {"gzip"}}, Body: ioutil.NopCloser(bytes.NewReader(buf.Bytes()))}
+	modifier := NewResponseModifier(nil, res)
+	defer modifier.body.close()
+
+	reader, err := modifier.ReadSeeker()
+	st.Expect(t, err, nil)
+	data, _ := ioutil.ReadAll(reader)
+	st.Expect(t, string(data), "Hello world")
+
+	// The body is left encoded
+	raw, _ := ioutil.ReadAll(res.Body)
+	st.Expect(t, raw, buf.Bytes())
+}
+
+func TestRequestModifierReadSeeker(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+
+	interceptor := RequestE(func(m *RequestModifier) error {
+		data := map[string]string{}
+		st.Expect(t, m.DecodeJSON(&data), nil)
+		st.Expect(t, data["hello"], "world")
+		st.Expect(t, tempFiles() > 0, true)
+
+		reader, err := m.ReadSeeker()
+		st.Expect(t, err, nil)
+		body, _ := ioutil.ReadAll(reader)
+		st.Expect(t, string(body), `{"hello": "world"}`)
+		return nil
+	})
+	interceptor.SpillThreshold = 4
+
+	req := chunkedRequest(`{"hello": "world"}`)
+	w := httptest.NewRecorder()
+	interceptor.HandleHTTP(w, req, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	st.Expect(t, w.Body.String(), `{"hello": "world"}`)
+	st.Expect(t, tempFiles(), 0)
+}
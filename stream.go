@@ -0,0 +1,223 @@
+package intercept
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// streamChunkSize defines the maximum amount of bytes written per chunk in streaming mode.
+const streamChunkSize = 32 * 1024
+
+// StreamModifierFunc defines the function interface for streaming http.Response modifiers.
+// The modifier receives the intercepted http.Response and a reader of the upstream body,
+// and returns the io.Reader that will be streamed to the client.
+// Returning nil streams the upstream body untouched.
+type StreamModifierFunc func(res *http.Response, body io.Reader) io.Reader
+
+// StreamInterceptor implements an http.ResponseWriter compatible interface that streams
+// the body written by the intercepted handler through a modifier function,
+// writing the transformed output to the client incrementally with bounded memory.
+type StreamInterceptor struct {
+	started  bool
+	response *http.Response
+	modifier StreamModifierFunc
+	writer   http.ResponseWriter
+	pipe     *io.PipeWriter
+	done     chan error
+
+	// mutex serializes the writes in the real http.ResponseWriter.
+	// A flush requested before the modifier is ready is deferred until the header is written.
+	mutex       sync.Mutex
+	wroteHeader bool
+	flushHeader bool
+}
+
+// NewStreamInterceptor creates a new http.ResponseWriter capable interface
+// that will stream the current response through the given modifier function.
+func NewStreamInterceptor(w http.ResponseWriter, req *http.Request, fn StreamModifierFunc) *StreamInterceptor {
+	res := &http.Response{
+		Request:       req,
+		StatusCode:    200,
+		Status:        "200 OK",
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		ContentLength: -1,
+	}
+	return &StreamInterceptor{writer: w, modifier: fn, response: res, done: make(chan error, 1)}
+}
+
+// Header returns the current response http.Header.
+func (w *StreamInterceptor) Header() http.Header {
+	return w.response.Header
+}
+
+// WriteHeader intercepts the desired response status code and starts streaming the response.
+func (w *StreamInterceptor) WriteHeader(status int) {
+	if w.started {
+		return
+	}
+	w.response.StatusCode = status
+	w.response.Status = strconv.Itoa(status) + " " + http.StatusText(status)
+	w.start()
+}
+
+// Write passes the given chunk of bytes to the stream modifier.
+// Write blocks until the modifier consumes the chunk.
+func (w *StreamInterceptor) Write(b []byte) (int, error) {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.pipe.Write(b)
+}
+
+// Done notifies the interceptor that the intercepted handler finished writing the response
+// and waits until the transformed body has been completely written to the client.
+func (w *StreamInterceptor) Done() error {
+	if !w.started {
+		w.start()
+	}
+	w.pipe.Close()
+	return <-w.done
+}
+
+// Flush sends the response header to the client if not sent yet, and flushes the body.
+// Written chunks are passed to the modifier as soon as they are written,
+// and its output is flushed to the client as it is produced.
+// Flush does not block: if the modifier function has not returned yet,
+// the header is flushed as soon as it returns.
+func (w *StreamInterceptor) Flush() {
+	if !w.started {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if !w.wroteHeader {
+		w.flushHeader = true
+		return
+	}
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+// This method is used by http.ResponseController.
+func (w *StreamInterceptor) Unwrap() http.ResponseWriter {
+	return w.writer
+}
+
+// abort stops streaming the response with the given error, if started,
+// and waits until the modifier goroutine ends.
+func (w *StreamInterceptor) abort(err error) {
+	if w.started {
+		w.pipe.CloseWithError(err)
+		<-w.done
+	}
+}
+
+// start calls the modifier function in a separate goroutine that
+// consumes the upstream body and writes the transformed one.
+func (w *StreamInterceptor) start() {
+	reader, writer := io.Pipe()
+	w.started = true
+	w.pipe = writer
+	w.response.Body = reader
+	go w.stream(reader)
+}
+
+// stream writes the final response header fields and the transformed body.
+func (w *StreamInterceptor) stream(body *io.PipeReader) {
+	out := w.modifier(w.response, body)
+	if out == nil {
+		out = body
+	}
+
+	// The final body length is unknown until the stream ends
+	w.mutex.Lock()
+	target := w.writer.Header()
+	for k, v := range w.response.Header {
+		target[k] = v
+	}
+	target.Del("Content-Length")
+	w.writer.WriteHeader(w.response.StatusCode)
+	w.wroteHeader = true
+	if flusher, ok := w.writer.(http.Flusher); ok && w.flushHeader {
+		flusher.Flush()
+	}
+	w.mutex.Unlock()
+
+	err := w.copy(out)
+
+	// Unblock the upstream writes if the modifier stopped consuming the body
+	body.CloseWithError(io.ErrClosedPipe)
+	w.done <- err
+}
+
+// copy writes the given reader in the real http.ResponseWriter,
+// flushing every chunk if supported, until the client goes away.
+func (w *StreamInterceptor) copy(reader io.Reader) error {
+	ctx := w.response.Request.Context()
+	flusher, _ := w.writer.(http.Flusher)
+	buf := make([]byte, streamChunkSize)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		n, err := reader.Read(buf)
+		if n > 0 {
+			if werr := w.write(buf[:n], flusher); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes and flushes the given chunk in the real http.ResponseWriter.
+func (w *StreamInterceptor) write(b []byte, flusher http.Flusher) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if _, err := w.writer.Write(b); err != nil {
+		return err
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// ResponseStream intercepts an HTTP response and streams its body through the given stream modifier function.
+func ResponseStream(fn StreamModifierFunc) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" || r.Method == "HEAD" {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			writer := NewStreamInterceptor(w, r, fn)
+			defer func() {
+				if err := recover(); err != nil {
+					// Release the modifier goroutine before propagating the panic
+					writer.abort(fmt.Errorf("intercept: handler panic: %v", err))
+					panic(err)
+				}
+			}()
+			h.ServeHTTP(writer, r)
+			writer.Done()
+		})
+	}
+}
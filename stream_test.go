@@ -0,0 +1,172 @@
+package intercept
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/nbio/st"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func upperLines(res *http.Response, body io.Reader) io.Reader {
+	reader, writer := io.Pipe()
+	go func() {
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			writer.Write([]byte(strings.ToUpper(scanner.Text()) + "\n"))
+		}
+		writer.CloseWithError(scanner.Err())
+	}()
+	return reader
+}
+
+func TestStreamInterceptor(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewStreamInterceptor(recorder, &http.Request{}, upperLines)
+	writer.Header().Set("Content-Length", "12")
+	writer.Header().Set("Content-Type", "text/plain")
+	writer.Write([]byte("hello\nwor"))
+	writer.Write([]byte("ld\n"))
+	err := writer.Done()
+	st.Expect(t, err, nil)
+	st.Expect(t, recorder.Code, 200)
+	st.Expect(t, recorder.Body.String(), "HELLO\nWORLD\n")
+	st.Expect(t, recorder.Header().Get("Content-Length"), "")
+	st.Expect(t, recorder.Header().Get("Content-Type"), "text/plain")
+	st.Expect(t, recorder.Flushed, true)
+}
+
+func TestStreamInterceptorStatus(t *testing.T) {
+	modifier := func(res *http.Response, body io.Reader) io.Reader {
+		res.Header.Set("X-Status", res.Status)
+		return nil
+	}
+	recorder := httptest.NewRecorder()
+	writer := NewStreamInterceptor(recorder, &http.Request{}, modifier)
+	writer.WriteHeader(404)
+	writer.Write([]byte("not found"))
+	writer.Done()
+	st.Expect(t, recorder.Code, 404)
+	st.Expect(t, recorder.Header().Get("X-Status"), "404 Not Found")
+	st.Expect(t, recorder.Body.String(), "not found")
+}
+
+func TestStreamInterceptorWithoutBody(t *testing.T) {
+	modifier := func(res *http.Response, body io.Reader) io.Reader {
+		return strings.NewReader("hello")
+	}
+	recorder := httptest.NewRecorder()
+	writer := NewStreamInterceptor(recorder, &http.Request{}, modifier)
+	writer.Done()
+	st.Expect(t, recorder.Body.String(), "hello")
+}
+
+func TestStreamInterceptorPartialRead(t *testing.T) {
+	modifier := func(res *http.Response, body io.Reader) io.Reader {
+		return io.LimitReader(body, 3)
+	}
+	recorder := httptest.NewRecorder()
+	writer := NewStreamInterceptor(recorder, &http.Request{}, modifier)
+	writer.Write([]byte("foo"))
+	_, err := writer.Write([]byte("bar"))
+	st.Expect(t, err, io.ErrClosedPipe)
+	writer.Done()
+	st.Expect(t, recorder.Body.String(), "foo")
+}
+
+func TestResponseStream(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo\n"))
+		w.Write([]byte("bar\n"))
+	})
+	recorder := httptest.NewRecorder()
+	ResponseStream(upperLines)(handler).ServeHTTP(recorder, &http.Request{Method: "GET"})
+	st.Expect(t, recorder.Body.String(), "FOO\nBAR\n")
+}
+
+func TestResponseStreamPanic(t *testing.T) {
+	done := make(chan error, 1)
+	modifier := func(res *http.Response, body io.Reader) io.Reader {
+		reader, writer := io.Pipe()
+		go func() {
+			_, err := io.Copy(writer, body)
+			done <- err
+			writer.CloseWithError(err)
+		}()
+		return reader
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+		panic("boom")
+	})
+
+	recorder := httptest.NewRecorder()
+	func() {
+		defer func() {
+			st.Expect(t, recover(), "boom")
+		}()
+		ResponseStream(modifier)(handler).ServeHTTP(recorder, &http.Request{Method: "GET"})
+	}()
+
+	// The stream is stopped before the panic is propagated
+	select {
+	case err := <-done:
+		st.Expect(t, err.Error(), "intercept: handler panic: boom")
+	default:
+		t.Fatal("stream goroutine still running")
+	}
+	st.Expect(t, recorder.Body.String(), "foo")
+}
+
+func TestResponseStreamFlush(t *testing.T) {
+	next := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, ok := w.(http.Flusher)
+		st.Expect(t, ok, true)
+		controller := http.NewResponseController(w)
+		st.Expect(t, controller.SetWriteDeadline(time.Time{}), nil)
+		st.Expect(t, controller.Flush(), nil)
+		<-next
+		w.Write([]byte("data: foo\n\n"))
+		w.(http.Flusher).Flush()
+		<-next
+	})
+	server := httptest.NewServer(ResponseStream(upperLines)(handler))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	st.Assert(t, err, nil)
+	defer res.Body.Close()
+	st.Expect(t, res.Header.Get("Content-Type"), "text/event-stream")
+
+	next <- struct{}{}
+	reader := bufio.NewReader(res.Body)
+	line, err := reader.ReadString('\n')
+	st.Expect(t, err, nil)
+	st.Expect(t, line, "DATA: FOO\n")
+	close(next)
+}
+
+func TestResponseStreamFlushBufferingModifier(t *testing.T) {
+	modifier := func(res *http.Response, body io.Reader) io.Reader {
+		buf, _ := ioutil.ReadAll(body)
+		return bytes.NewReader(bytes.ToUpper(buf))
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("bar"))
+	})
+
+	// Flush does not wait for the modifier to return
+	recorder := httptest.NewRecorder()
+	ResponseStream(modifier)(handler).ServeHTTP(recorder, &http.Request{Method: "GET"})
+	st.Expect(t, recorder.Body.String(), "FOOBAR")
+	st.Expect(t, recorder.Flushed, true)
+}
@@ -0,0 +1,111 @@
+package intercept
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SetPath sets the given path as http.Request URL path.
+func (s *RequestModifier) SetPath(path string) {
+	s.Request.URL.Path = path
+	s.Request.URL.RawPath = ""
+	s.syncURL()
+}
+
+// AddPathPrefix prepends the given prefix to the http.Request URL path.
+func (s *RequestModifier) AddPathPrefix(prefix string) {
+	u := s.Request.URL
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		return
+	}
+
+	u.Path = prefix + ensureLeadingSlash(u.Path)
+	if u.RawPath != "" {
+		u.RawPath = prefix + ensureLeadingSlash(u.RawPath)
+	}
+	s.syncURL()
+}
+
+// StripPathPrefix removes the given prefix from the http.Request URL path.
+// It returns false if the path does not start with the given prefix,
+// matching whole path segments: "/api" is not a prefix of "/apiv2".
+func (s *RequestModifier) StripPathPrefix(prefix string) bool {
+	u := s.Request.URL
+	path, ok := replacePathPrefix(u.Path, prefix, "")
+	if !ok {
+		return false
+	}
+	rawPath, ok := replacePathPrefix(u.RawPath, prefix, "")
+	if u.RawPath != "" && !ok {
+		return false
+	}
+
+	u.Path = path
+	if u.RawPath != "" {
+		u.RawPath = rawPath
+	}
+	s.syncURL()
+	return true
+}
+
+// RewritePath replaces the matches of the given regular expression in the http.Request URL path
+// with the given replacement, which can refer to capture groups as $1 or ${name}.
+// It returns false if the path does not match the regular expression.
+func (s *RequestModifier) RewritePath(re *regexp.Regexp, replacement string) bool {
+	if !re.MatchString(s.Request.URL.Path) {
+		return false
+	}
+	s.SetPath(re.ReplaceAllString(s.Request.URL.Path, replacement))
+	return true
+}
+
+// SetQuery sets the given http.Request URL query parameter, replacing any existing values.
+func (s *RequestModifier) SetQuery(key, value string) {
+	query := s.Request.URL.Query()
+	query.Set(key, value)
+	s.Request.URL.RawQuery = query.Encode()
+	s.syncURL()
+}
+
+// AddQuery adds the given value to the http.Request URL query parameter.
+func (s *RequestModifier) AddQuery(key, value string) {
+	query := s.Request.URL.Query()
+	query.Add(key, value)
+	s.Request.URL.RawQuery = query.Encode()
+	s.syncURL()
+}
+
+// DelQuery deletes the given http.Request URL query parameter.
+func (s *RequestModifier) DelQuery(key string) {
+	query := s.Request.URL.Query()
+	query.Del(key)
+	s.Request.URL.RawQuery = query.Encode()
+	s.syncURL()
+}
+
+// SetScheme sets the given scheme in the http.Request URL.
+func (s *RequestModifier) SetScheme(scheme string) {
+	s.Request.URL.Scheme = scheme
+}
+
+// SetHost sets the given host in both the http.Request URL and Host fields.
+func (s *RequestModifier) SetHost(host string) {
+	s.Request.URL.Host = host
+	s.Request.Host = host
+}
+
+// syncURL updates the http.Request RequestURI, if defined, to match the current URL.
+func (s *RequestModifier) syncURL() {
+	if s.Request.RequestURI != "" {
+		s.Request.RequestURI = s.Request.URL.RequestURI()
+	}
+}
+
+// ensureLeadingSlash returns the given path starting with a slash.
+func ensureLeadingSlash(path string) string {
+	if strings.HasPrefix(path, "/") {
+		return path
+	}
+	return "/" + path
+}
@@ -0,0 +1,90 @@
+package intercept
+
+import (
+	"github.com/nbio/st"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+func newURLRequest(target string) *http.Request {
+	req, _ := http.NewRequest("GET", target, nil)
+	req.RequestURI = req.URL.RequestURI()
+	return req
+}
+
+func TestSetPath(t *testing.T) {
+	req := newURLRequest("http://example.com/foo?bar=baz")
+	NewRequestModifier(req).SetPath("/html")
+	st.Expect(t, req.URL.Path, "/html")
+	st.Expect(t, req.RequestURI, "/html?bar=baz")
+}
+
+func TestSetPathWithoutRequestURI(t *testing.T) {
+	req, _ := http.NewRequest("GET", "http://example.com/foo", nil)
+	NewRequestModifier(req).SetPath("/html")
+	st.Expect(t, req.URL.Path, "/html")
+	st.Expect(t, req.RequestURI, "")
+}
+
+func TestAddPathPrefix(t *testing.T) {
+	req := newURLRequest("http://example.com/users")
+	NewRequestModifier(req).AddPathPrefix("/api/")
+	st.Expect(t, req.URL.Path, "/api/users")
+	st.Expect(t, req.RequestURI, "/api/users")
+}
+
+func TestStripPathPrefix(t *testing.T) {
+	req := newURLRequest("http://example.com/api/users/a%2Fb")
+	modifier := NewRequestModifier(req)
+	st.Expect(t, modifier.StripPathPrefix("/api"), true)
+	st.Expect(t, req.URL.Path, "/users/a/b")
+	st.Expect(t, req.URL.RawPath, "/users/a%2Fb")
+	st.Expect(t, req.RequestURI, "/users/a%2Fb")
+
+	st.Expect(t, modifier.StripPathPrefix("/api"), false)
+	st.Expect(t, req.URL.Path, "/users/a/b")
+
+	st.Expect(t, modifier.StripPathPrefix("/users/"), true)
+	st.Expect(t, req.URL.Path, "/a/b")
+
+	// Prefixes match whole path segments
+	req = newURLRequest("http://example.com/apiv2/users")
+	modifier = NewRequestModifier(req)
+	st.Expect(t, modifier.StripPathPrefix("/api"), false)
+	st.Expect(t, req.URL.Path, "/apiv2/users")
+	st.Expect(t, modifier.StripPathPrefix("/apiv2"), true)
+	st.Expect(t, req.URL.Path, "/users")
+	st.Expect(t, modifier.StripPathPrefix("/users"), true)
+	st.Expect(t, req.URL.Path, "/")
+}
+
+func TestRewritePath(t *testing.T) {
+	req := newURLRequest("http://example.com/users/123/profile?full=true")
+	modifier := NewRequestModifier(req)
+	re := regexp.MustCompile(`^/users/(?P<id>\d+)/profile$`)
+	st.Expect(t, modifier.RewritePath(re, "/profiles/${id}"), true)
+	st.Expect(t, req.URL.Path, "/profiles/123")
+	st.Expect(t, req.RequestURI, "/profiles/123?full=true")
+	st.Expect(t, modifier.RewritePath(re, "/foo"), false)
+}
+
+func TestQueryHelpers(t *testing.T) {
+	req := newURLRequest("http://example.com/?foo=bar&debug=1")
+	modifier := NewRequestModifier(req)
+	modifier.SetQuery("foo", "baz")
+	modifier.AddQuery("tag", "a")
+	modifier.AddQuery("tag", "b")
+	modifier.DelQuery("debug")
+	st.Expect(t, req.URL.RawQuery, "foo=baz&tag=a&tag=b")
+	st.Expect(t, req.RequestURI, "/?foo=baz&tag=a&tag=b")
+}
+
+func TestSetSchemeAndHost(t *testing.T) {
+	req := newURLRequest("http://example.com/")
+	modifier := NewRequestModifier(req)
+	modifier.SetScheme("https")
+	modifier.SetHost("api.example.com:8443")
+	st.Expect(t, req.URL.String(), "https://api.example.com:8443/")
+	st.Expect(t, req.Host, "api.example.com:8443")
+}
@@ -0,0 +1,219 @@
+package intercept
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+)
+
+// Flush writes the buffered response untouched to the client and flushes it.
+// Flushing disables the interception of the current response,
+// so any further body chunk is directly written to the client.
+func (w *WriterInterceptor) Flush() {
+	w.filter()
+	if !w.bypass {
+		w.passthrough()
+		w.writeBuffered()
+	}
+
+	if flusher, ok := w.writer.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack lets the caller take over the underlying connection.
+// Hijacking disables the interception of the current response.
+func (w *WriterInterceptor) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.writer.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	w.filtered = true
+	w.bypass = true
+	w.headerWritten = true
+	w.buf = nil
+	return hijacker.Hijack()
+}
+
+// Push initiates an HTTP/2 server push using the underlying http.ResponseWriter.
+func (w *WriterInterceptor) Push(target string, opts *http.PushOptions) error {
+	pusher, ok := w.writer.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return pusher.Push(target, opts)
+}
+
+// ReadFrom reads data from the given reader as part of the response body.
+// Data is buffered unless the interception has been disabled.
+func (w *WriterInterceptor) ReadFrom(r io.Reader) (int64, error) {
+	w.filter()
+	if w.bypass {
+		if readerFrom, ok := w.writer.(io.ReaderFrom); ok {
+			return readerFrom.ReadFrom(r)
+		}
+		return io.Copy(w.writer, r)
+	}
+	if w.closed {
+		return 0, nil
+	}
+	if w.maxBodySize > 0 || w.threshold > 0 {
+		// Write the chunks through the body size limits and spill buffer
+		return io.Copy(struct{ io.Writer }{w}, r)
+	}
+
+	buf := bytes.NewBuffer(w.buf)
+	n, err := buf.ReadFrom(r)
+	w.buf = buf.Bytes()
+	return n, err
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+// This method is used by http.ResponseController.
+func (w *WriterInterceptor) Unwrap() http.ResponseWriter {
+	return w.writer
+}
+
+// unwrapper is implemented by http.ResponseWriter wrappers compatible with http.ResponseController.
+type unwrapper interface {
+	http.ResponseWriter
+	Unwrap() http.ResponseWriter
+}
+
+// ResponseWriter returns an http.ResponseWriter that intercepts the current response,
+// implementing exactly the optional interfaces supported by the underlying http.ResponseWriter
+// among http.Flusher, http.Hijacker, http.Pusher and io.ReaderFrom.
+func (w *WriterInterceptor) ResponseWriter() http.ResponseWriter {
+	return exposeFeatures(w)
+}
+
+// featureWriter is implemented by the http.ResponseWriter interceptors
+// supporting every optional interface of the underlying http.ResponseWriter.
+type featureWriter interface {
+	unwrapper
+	http.Flusher
+	http.Hijacker
+	http.Pusher
+	io.ReaderFrom
+}
+
+// exposeFeatures returns an http.ResponseWriter that implements exactly the optional interfaces
+// of the given interceptor supported by its underlying http.ResponseWriter.
+func exposeFeatures(w featureWriter) http.ResponseWriter {
+	var features int
+	writer := w.Unwrap()
+	if _, ok := writer.(http.Flusher); ok {
+		features |= 1
+	}
+	if _, ok := writer.(http.Hijacker); ok {
+		features |= 2
+	}
+	if _, ok := writer.(http.Pusher); ok {
+		features |= 4
+	}
+	if _, ok := writer.(io.ReaderFrom); ok {
+		features |= 8
+	}
+
+	switch features {
+	case 1:
+		return struct {
+			unwrapper
+			http.Flusher
+		}{w, w}
+	case 2:
+		return struct {
+			unwrapper
+			http.Hijacker
+		}{w, w}
+	case 3:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+		}{w, w, w}
+	case 4:
+		return struct {
+			unwrapper
+			http.Pusher
+		}{w, w}
+	case 5:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Pusher
+		}{w, w, w}
+	case 6:
+		return struct {
+			unwrapper
+			http.Hijacker
+			http.Pusher
+		}{w, w, w}
+	case 7:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, w, w, w}
+	case 8:
+		return struct {
+			unwrapper
+			io.ReaderFrom
+		}{w, w}
+	case 9:
+		return struct {
+			unwrapper
+			http.Flusher
+			io.ReaderFrom
+		}{w, w, w}
+	case 10:
+		return struct {
+			unwrapper
+			http.Hijacker
+			io.ReaderFrom
+		}{w, w, w}
+	case 11:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{w, w, w, w}
+	case 12:
+		return struct {
+			unwrapper
+			http.Pusher
+			io.ReaderFrom
+		}{w, w, w}
+	case 13:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Pusher
+			io.ReaderFrom
+		}{w, w, w, w}
+	case 14:
+		return struct {
+			unwrapper
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, w, w, w}
+	case 15:
+		return struct {
+			unwrapper
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.ReaderFrom
+		}{w, w, w, w, w}
+	}
+
+	return struct {
+		unwrapper
+	}{w}
+}
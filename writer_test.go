@@ -0,0 +1,122 @@
+package intercept
+
+import (
+	"bufio"
+	"github.com/nbio/st"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type hijackWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+type readerFromWriter struct {
+	http.ResponseWriter
+}
+
+func (w *readerFromWriter) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(w.ResponseWriter, r)
+}
+
+func upperModifier(m *ResponseModifier) {
+	str, _ := m.ReadString()
+	m.String(strings.ToUpper(str))
+}
+
+func TestResponseWriterInterfaces(t *testing.T) {
+	writer := NewWriterInterceptor(httptest.NewRecorder(), &http.Request{}, upperModifier).ResponseWriter()
+	_, flusher := writer.(http.Flusher)
+	_, hijacker := writer.(http.Hijacker)
+	_, pusher := writer.(http.Pusher)
+	_, readerFrom := writer.(io.ReaderFrom)
+	st.Expect(t, flusher, true)
+	st.Expect(t, hijacker, false)
+	st.Expect(t, pusher, false)
+	st.Expect(t, readerFrom, false)
+
+	writer = NewWriterInterceptor(&hijackWriter{ResponseRecorder: httptest.NewRecorder()}, &http.Request{}, upperModifier).ResponseWriter()
+	_, flusher = writer.(http.Flusher)
+	_, hijacker = writer.(http.Hijacker)
+	st.Expect(t, flusher, true)
+	st.Expect(t, hijacker, true)
+
+	writer = NewWriterInterceptor(&readerFromWriter{httptest.NewRecorder()}, &http.Request{}, upperModifier).ResponseWriter()
+	_, flusher = writer.(http.Flusher)
+	_, readerFrom = writer.(io.ReaderFrom)
+	st.Expect(t, flusher, false)
+	st.Expect(t, readerFrom, true)
+}
+
+func TestWriterInterceptorFlush(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, upperModifier)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Write([]byte("foo"))
+	writer.Flush()
+	st.Expect(t, recorder.Flushed, true)
+	st.Expect(t, recorder.Body.String(), "foo")
+	st.Expect(t, recorder.Header().Get("Content-Type"), "text/event-stream")
+
+	writer.Write([]byte("bar"))
+	st.Expect(t, recorder.Body.String(), "foobar")
+	writer.Done()
+	st.Expect(t, recorder.Body.String(), "foobar")
+}
+
+func TestWriterInterceptorHijack(t *testing.T) {
+	recorder := &hijackWriter{ResponseRecorder: httptest.NewRecorder()}
+	writer := NewWriterInterceptor(recorder, &http.Request{}, upperModifier)
+	_, _, err := writer.Hijack()
+	st.Expect(t, err, nil)
+	st.Expect(t, recorder.hijacked, true)
+	n, err := writer.Done()
+	st.Expect(t, n, 0)
+	st.Expect(t, err, nil)
+	st.Expect(t, recorder.Body.Len(), 0)
+
+	_, _, err = NewWriterInterceptor(httptest.NewRecorder(), &http.Request{}, upperModifier).Hijack()
+	st.Expect(t, err, http.ErrNotSupported)
+}
+
+func TestWriterInterceptorReadFrom(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(&readerFromWriter{recorder}, &http.Request{}, upperModifier)
+	n, err := writer.ReadFrom(strings.NewReader("foo"))
+	st.Expect(t, err, nil)
+	st.Expect(t, n, int64(3))
+	st.Expect(t, recorder.Body.Len(), 0)
+	writer.Done()
+	st.Expect(t, recorder.Body.String(), "FOO")
+}
+
+func TestWriterInterceptorResponseController(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	writer := NewWriterInterceptor(recorder, &http.Request{}, upperModifier)
+	controller := http.NewResponseController(writer.ResponseWriter())
+	writer.Write([]byte("foo"))
+	st.Expect(t, controller.Flush(), nil)
+	st.Expect(t, recorder.Body.String(), "foo")
+	st.Expect(t, writer.Unwrap(), http.ResponseWriter(recorder))
+}
+
+func TestResponseFlushBypass(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("data: foo\n\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("data: bar\n\n"))
+	})
+	recorder := httptest.NewRecorder()
+	Response(upperModifier)(handler).ServeHTTP(recorder, &http.Request{Method: "GET"})
+	st.Expect(t, recorder.Body.String(), "data: foo\n\ndata: bar\n\n")
+}